@@ -0,0 +1,403 @@
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// Packet is implemented by all types that describe the layout of a packet.
+//
+// The fields of a packet are encoded in order using the type given in their "packet" tag:
+//
+//	byte     an 8-bit integer
+//	integer  a 16-bit integer
+//	long     a 32-bit integer
+//	string   a string prefixed with its length as a 16-bit integer
+//	utf16    a fixed length string of UTF-16 characters padded with spaces; requires len=<n>
+//
+// Integer and boolean fields must specify their type. Strings default to the string type.
+// Arrays are encoded as their elements using the type of the field, and slices are additionally
+// prefixed with the number of elements, whose type is given by count=<type>.
+// Nested structs are encoded field by field. Fields tagged with "-" are not encoded.
+//
+// Fields that were added in a later version of the protocol specify the version with since=<n>.
+// They are only encoded when the version of the writer or reader is zero or at least n.
+type Packet interface {
+	PacketId() int
+}
+
+type encodeFunc func(w *PacketWriter, v reflect.Value)
+type decodeFunc func(r *PacketReader, v reflect.Value)
+
+type codec struct {
+	encode encodeFunc
+	decode decodeFunc
+}
+
+type tagOptions struct {
+	kind   string
+	length int
+	count  string
+	since  int
+}
+
+var codecs sync.Map
+
+// EncodePacket returns the bytes of the specified packet, starting with its packet id.
+func EncodePacket(p Packet) []byte {
+	return EncodePacketVersion(p, 0)
+}
+
+// EncodePacketVersion returns the bytes of the specified packet as encoded for the specified protocol version.
+func EncodePacketVersion(p Packet, version int) []byte {
+	w := NewWriter()
+	w.SetVersion(version)
+	w.WritePacket(p)
+	return w.Bytes()
+}
+
+// PacketCache encodes a packet at most once for each protocol version it is requested with.
+// It is used when the same packet is sent to many connections that may use different versions of the protocol.
+type PacketCache struct {
+	packet Packet
+	mu     sync.Mutex
+	bytes  map[int][]byte
+}
+
+// NewPacketCache returns a new cache for the specified packet.
+// The packet must not be modified after the cache has been created.
+func NewPacketCache(p Packet) *PacketCache {
+	return &PacketCache{
+		packet: p,
+		bytes:  make(map[int][]byte),
+	}
+}
+
+// Bytes returns the bytes of the packet as encoded for the specified protocol version.
+func (c *PacketCache) Bytes(version int) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bytes, ok := c.bytes[version]
+	if !ok {
+		bytes = EncodePacketVersion(c.packet, version)
+		c.bytes[version] = bytes
+	}
+
+	return bytes
+}
+
+// WritePacket writes the id of the packet followed by all of its fields.
+func (w *PacketWriter) WritePacket(p Packet) {
+	v := reflect.Indirect(reflect.ValueOf(p))
+
+	w.WriteInteger(p.PacketId())
+
+	getCodec(v.Type()).encode(w, v)
+}
+
+// ReadPacket reads the fields of the packet that p points to. The packet id must already have been read.
+// The returned error is the same as the one returned by Err.
+func (r *PacketReader) ReadPacket(p Packet) error {
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		panic("packet: ReadPacket requires a non-nil pointer")
+	}
+
+	v = v.Elem()
+
+	getCodec(v.Type()).decode(r, v)
+
+	return r.err
+}
+
+// getCodec returns the codec for the specified packet type, building it on first use.
+func getCodec(t reflect.Type) *codec {
+	if c, ok := codecs.Load(t); ok {
+		return c.(*codec)
+	}
+
+	c, err := buildCodec(t, tagOptions{})
+	if err != nil {
+		panic(fmt.Sprintf("packet: %s: %s", t, err))
+	}
+
+	actual, _ := codecs.LoadOrStore(t, c)
+
+	return actual.(*codec)
+}
+
+func parseTag(tag string) (tagOptions, error) {
+	var opts tagOptions
+
+	parts := strings.Split(tag, ",")
+
+	opts.kind = parts[0]
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "len":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid length %q", value)
+			}
+			opts.length = n
+		case "count":
+			opts.count = value
+		case "since":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid version %q", value)
+			}
+			opts.since = n
+		default:
+			return opts, fmt.Errorf("unknown option %q", key)
+		}
+	}
+
+	return opts, nil
+}
+
+func buildCodec(t reflect.Type, opts tagOptions) (*codec, error) {
+	switch t.Kind() {
+	case reflect.Struct:
+		return buildStructCodec(t)
+
+	case reflect.Array:
+		return buildArrayCodec(t, opts)
+
+	case reflect.Slice:
+		return buildSliceCodec(t, opts)
+
+	case reflect.String:
+		return buildStringCodec(opts)
+
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return buildNumberCodec(t, opts.kind)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func buildStructCodec(t reflect.Type) (*codec, error) {
+	type field struct {
+		index int
+		since int
+		codec *codec
+	}
+
+	fields := make([]field, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag := sf.Tag.Get("packet")
+		if tag == "-" {
+			continue
+		}
+
+		opts, err := parseTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+		}
+
+		c, err := buildCodec(sf.Type, opts)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+		}
+
+		fields = append(fields, field{index: i, since: opts.since, codec: c})
+	}
+
+	return &codec{
+		encode: func(w *PacketWriter, v reflect.Value) {
+			for _, f := range fields {
+				if hasVersion(w.version, f.since) {
+					f.codec.encode(w, v.Field(f.index))
+				}
+			}
+		},
+		decode: func(r *PacketReader, v reflect.Value) {
+			for _, f := range fields {
+				if hasVersion(r.version, f.since) {
+					f.codec.decode(r, v.Field(f.index))
+				}
+			}
+		},
+	}, nil
+}
+
+// hasVersion returns true if a field added in the since version is present in the specified version.
+func hasVersion(version int, since int) bool {
+	return version == 0 || version >= since
+}
+
+func buildArrayCodec(t reflect.Type, opts tagOptions) (*codec, error) {
+	elem, err := buildCodec(t.Elem(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &codec{
+		encode: func(w *PacketWriter, v reflect.Value) {
+			for i := 0; i < v.Len(); i++ {
+				elem.encode(w, v.Index(i))
+			}
+		},
+		decode: func(r *PacketReader, v reflect.Value) {
+			for i := 0; i < v.Len(); i++ {
+				elem.decode(r, v.Index(i))
+			}
+		},
+	}, nil
+}
+
+func buildSliceCodec(t reflect.Type, opts tagOptions) (*codec, error) {
+	if opts.count == "" {
+		return nil, fmt.Errorf("slice requires a count type")
+	}
+
+	count, err := buildNumberCodec(reflect.TypeFor[int](), opts.count)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.count = ""
+
+	elem, err := buildCodec(t.Elem(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &codec{
+		encode: func(w *PacketWriter, v reflect.Value) {
+			count.encode(w, reflect.ValueOf(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				elem.encode(w, v.Index(i))
+			}
+		},
+		decode: func(r *PacketReader, v reflect.Value) {
+			var n int
+			count.decode(r, reflect.ValueOf(&n).Elem())
+
+			// Every element takes at least one byte, which bounds the number of elements that can be present
+			if n > r.Remaining() {
+				r.fail(ErrUnexpectedEnd)
+				return
+			}
+
+			v.Set(reflect.MakeSlice(t, n, n))
+			for i := 0; i < n; i++ {
+				elem.decode(r, v.Index(i))
+			}
+		},
+	}, nil
+}
+
+func buildStringCodec(opts tagOptions) (*codec, error) {
+	switch opts.kind {
+	case "", "string":
+		return &codec{
+			encode: func(w *PacketWriter, v reflect.Value) { w.WriteString(v.String()) },
+			decode: func(r *PacketReader, v reflect.Value) { v.SetString(r.ReadString()) },
+		}, nil
+
+	case "utf16":
+		if opts.length == 0 {
+			return nil, fmt.Errorf("utf16 string requires a length")
+		}
+
+		length := opts.length
+
+		return &codec{
+			encode: func(w *PacketWriter, v reflect.Value) { w.Write(encodeUtf16(v.String(), length)) },
+			decode: func(r *PacketReader, v reflect.Value) { v.SetString(decodeUtf16(r.Read(length * 2))) },
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid type %q for string", opts.kind)
+}
+
+func buildNumberCodec(t reflect.Type, kind string) (*codec, error) {
+	var write func(w *PacketWriter, value int)
+	var read func(r *PacketReader) int
+
+	switch kind {
+	case "byte":
+		write = func(w *PacketWriter, value int) { _ = w.WriteByte(byte(value)) }
+		read = func(r *PacketReader) int { value, _ := r.ReadByte(); return int(value) }
+	case "integer":
+		write = (*PacketWriter).WriteInteger
+		read = (*PacketReader).ReadInteger
+	case "long":
+		write = (*PacketWriter).WriteLong
+		read = (*PacketReader).ReadLong
+	case "":
+		return nil, fmt.Errorf("missing type for %s", t)
+	default:
+		return nil, fmt.Errorf("invalid type %q for %s", kind, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &codec{
+			encode: func(w *PacketWriter, v reflect.Value) {
+				if v.Bool() {
+					write(w, 1)
+				} else {
+					write(w, 0)
+				}
+			},
+			decode: func(r *PacketReader, v reflect.Value) { v.SetBool(read(r) != 0) },
+		}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &codec{
+			encode: func(w *PacketWriter, v reflect.Value) { write(w, int(v.Uint())) },
+			decode: func(r *PacketReader, v reflect.Value) { v.SetUint(uint64(read(r))) },
+		}, nil
+	}
+
+	return &codec{
+		encode: func(w *PacketWriter, v reflect.Value) { write(w, int(v.Int())) },
+		decode: func(r *PacketReader, v reflect.Value) { v.SetInt(int64(read(r))) },
+	}, nil
+}
+
+// encodeUtf16 converts a string to a fixed number of UTF-16 characters, padded with spaces.
+func encodeUtf16(s string, length int) []byte {
+	const space uint16 = 0x20
+
+	bytes := make([]byte, length*2)
+
+	codes := utf16.Encode([]rune(s))
+	for i := 0; i < length; i++ {
+		if i < len(codes) {
+			binary.LittleEndian.PutUint16(bytes[i*2:], codes[i])
+		} else {
+			binary.LittleEndian.PutUint16(bytes[i*2:], space)
+		}
+	}
+
+	return bytes
+}
+
+// decodeUtf16 converts a string of UTF-16 characters back to a string, removing the padding.
+func decodeUtf16(bytes []byte) string {
+	codes := make([]uint16, len(bytes)/2)
+	for i := 0; i < len(codes); i++ {
+		codes[i] = binary.LittleEndian.Uint16(bytes[i*2:])
+	}
+
+	return strings.TrimSpace(string(utf16.Decode(codes)))
+}
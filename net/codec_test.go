@@ -0,0 +1,229 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+const testPacketId = 42
+
+type testTile struct {
+	Num   [3]int `packet:"integer"`
+	Type  int    `packet:"integer"`
+	Data1 int    `packet:"integer"`
+}
+
+// testLevel has the same layout as the level data sent to clients, with fewer tiles.
+type testLevel struct {
+	Name     string `packet:"utf16,len=8"`
+	Revision int    `packet:"long"`
+	Type     uint8  `packet:"integer"`
+	BootX    int    `packet:"byte"`
+	BootY    int    `packet:"byte"`
+	Tiles    [2]testTile
+	Npcs     [3]int `packet:"byte"`
+}
+
+type testPacket struct {
+	Message string `packet:"string"`
+	Level   testLevel
+	Visible bool   `packet:"byte"`
+	Items   []int  `packet:"integer,count=byte"`
+	Color   int    `packet:"byte,since=2"`
+	Tag     string `packet:"string,since=3"`
+}
+
+func (testPacket) PacketId() int { return testPacketId }
+
+// legacyUtf16 is the hand-written conversion the codec replaced.
+func legacyUtf16(s string, maxLen int) []byte {
+	bytes := make([]byte, maxLen*2)
+
+	codes := utf16.Encode([]rune(s))
+	for i := 0; i < maxLen; i++ {
+		if i < len(codes) {
+			binary.LittleEndian.PutUint16(bytes[i*2:], codes[i])
+		} else {
+			binary.LittleEndian.PutUint16(bytes[i*2:], 0x20)
+		}
+	}
+
+	return bytes
+}
+
+// legacyEncode writes the packet field by field, the way the packets were written before the codec existed.
+func legacyEncode(p *testPacket, version int) []byte {
+	w := NewWriter()
+
+	w.WriteInteger(testPacketId)
+	w.WriteString(p.Message)
+	w.Write(legacyUtf16(p.Level.Name, 8))
+	w.WriteLong(p.Level.Revision)
+	w.WriteInteger(int(p.Level.Type))
+	_ = w.WriteByte(byte(p.Level.BootX))
+	_ = w.WriteByte(byte(p.Level.BootY))
+	for _, tile := range p.Level.Tiles {
+		for _, num := range tile.Num {
+			w.WriteInteger(num)
+		}
+		w.WriteInteger(tile.Type)
+		w.WriteInteger(tile.Data1)
+	}
+	for _, npc := range p.Level.Npcs {
+		_ = w.WriteByte(byte(npc))
+	}
+	if p.Visible {
+		_ = w.WriteByte(1)
+	} else {
+		_ = w.WriteByte(0)
+	}
+	_ = w.WriteByte(byte(len(p.Items)))
+	for _, item := range p.Items {
+		w.WriteInteger(item)
+	}
+	if version == 0 || version >= 2 {
+		_ = w.WriteByte(byte(p.Color))
+	}
+	if version == 0 || version >= 3 {
+		w.WriteString(p.Tag)
+	}
+
+	return w.Bytes()
+}
+
+func newTestPacket() *testPacket {
+	return &testPacket{
+		Message: "Welcome to Mirage",
+		Level: testLevel{
+			Name:     "Tëst ☃",
+			Revision: 70000,
+			Type:     2,
+			BootX:    14,
+			BootY:    200,
+			Tiles: [2]testTile{
+				{Num: [3]int{1, 2, 3}, Type: 4, Data1: 500},
+				{Num: [3]int{0, 65535, 0}, Type: 1, Data1: 0},
+			},
+			Npcs: [3]int{1, 0, 255},
+		},
+		Visible: true,
+		Items:   []int{7, 8, 9},
+		Color:   12,
+		Tag:     "new",
+	}
+}
+
+func TestEncodeMatchesLegacyEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet *testPacket
+	}{
+		{"full", newTestPacket()},
+		{"empty", &testPacket{}},
+		{"long name", &testPacket{Level: testLevel{Name: "A name that does not fit"}}},
+		{"surrogate pair", &testPacket{Level: testLevel{Name: "𝄞 clef"}}},
+	}
+
+	for _, tt := range tests {
+		for _, version := range []int{0, 1, 2, 3} {
+			got := EncodePacketVersion(tt.packet, version)
+			want := legacyEncode(tt.packet, version)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s, version %d: encoded\n%v\nwant\n%v", tt.name, version, got, want)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		want    func(p *testPacket)
+	}{
+		{"all versions", 0, func(p *testPacket) {}},
+		{"version 1", 1, func(p *testPacket) { p.Color = 0; p.Tag = "" }},
+		{"version 2", 2, func(p *testPacket) { p.Tag = "" }},
+		{"version 3", 3, func(p *testPacket) {}},
+	}
+
+	for _, tt := range tests {
+		bytes := EncodePacketVersion(newTestPacket(), tt.version)
+
+		r := NewReader(bytes)
+		r.SetVersion(tt.version)
+		if id := r.ReadInteger(); id != testPacketId {
+			t.Errorf("%s: read packet id %d, want %d", tt.name, id, testPacketId)
+		}
+
+		var got testPacket
+		if err := r.ReadPacket(&got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if r.Remaining() != 0 {
+			t.Errorf("%s: %d bytes left after reading the packet", tt.name, r.Remaining())
+		}
+
+		want := newTestPacket()
+		tt.want(want)
+		if !reflect.DeepEqual(&got, want) {
+			t.Errorf("%s: read %+v, want %+v", tt.name, got, *want)
+		}
+	}
+}
+
+func TestUtf16Padding(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"  padded  ", "padded"},
+		{"exactly8", "exactly8"},
+		{"truncated name", "truncate"},
+		{"ünïcödé", "ünïcödé"},
+	}
+
+	for _, tt := range tests {
+		encoded := encodeUtf16(tt.in, 8)
+		if !bytes.Equal(encoded, legacyUtf16(tt.in, 8)) {
+			t.Errorf("encodeUtf16(%q) = %v, want %v", tt.in, encoded, legacyUtf16(tt.in, 8))
+		}
+		if got := decodeUtf16(encoded); got != tt.want {
+			t.Errorf("decodeUtf16(encodeUtf16(%q)) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPacketCacheEncodesPerVersion(t *testing.T) {
+	p := newTestPacket()
+	cache := NewPacketCache(p)
+
+	for _, version := range []int{1, 2, 3, 0} {
+		if got, want := cache.Bytes(version), EncodePacketVersion(p, version); !bytes.Equal(got, want) {
+			t.Errorf("version %d: cached %v, want %v", version, got, want)
+		}
+	}
+	if len(cache.Bytes(1)) >= len(cache.Bytes(2)) {
+		t.Errorf("version 1 should not include the fields added in version 2")
+	}
+}
+
+type invalidPacket struct {
+	Value int
+}
+
+func (invalidPacket) PacketId() int { return 0 }
+
+func TestInvalidPacketPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("encoding a field without a type did not panic")
+		}
+	}()
+	EncodePacket(invalidPacket{})
+}
@@ -0,0 +1,68 @@
+package net
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Connections that negotiated compression use the highest bit of the frame header to mark compressed payloads,
+// which leaves 15 bits for the size. All other connections use the full 16 bits of the header for the size.
+const (
+	FrameCompressed    = 0x8000 // The bit in the frame header that is set when the payload of the frame is compressed.
+	FrameSizeMask      = 0x7FFF // The bits in the frame header that hold the size of the payload.
+	MaxFrameSize       = 0x7FFF // The maximum size of the payload of a single frame.
+	MaxLegacyFrameSize = 0xFFFF // The maximum size of the payload of a single frame on connections that did not negotiate compression.
+)
+
+// ParseFrameHeader returns the size of the payload of a frame and whether the payload is compressed.
+func ParseFrameHeader(header int, compression bool) (int, bool) {
+	if !compression {
+		return header, false
+	}
+	return header & FrameSizeMask, header&FrameCompressed != 0
+}
+
+var ErrPacketTooLarge = errors.New("packet: decompressed packet exceeds the maximum size")
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// Compress returns the specified bytes compressed using DEFLATE.
+func Compress(data []byte) []byte {
+	var buf bytes.Buffer
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+
+	w.Reset(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+
+	return buf.Bytes()
+}
+
+// Decompress returns the DEFLATE compressed bytes decompressed.
+// ErrPacketTooLarge is returned when the decompressed bytes would exceed maxSize,
+// which protects against small payloads that expand to a very large size.
+func Decompress(data []byte, maxSize int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	result, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) > maxSize {
+		return nil, ErrPacketTooLarge
+	}
+
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseFrameHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         int
+		compression    bool
+		wantSize       int
+		wantCompressed bool
+	}{
+		{"plain", 0x0010, true, 0x0010, false},
+		{"compressed", FrameCompressed | 0x0010, true, 0x0010, true},
+		{"largest frame", MaxFrameSize, true, MaxFrameSize, false},
+		{"largest compressed frame", FrameCompressed | MaxFrameSize, true, MaxFrameSize, true},
+		{"legacy", 0x0010, false, 0x0010, false},
+		{"legacy with high bit", FrameCompressed | 0x0010, false, FrameCompressed | 0x0010, false},
+		{"largest legacy frame", MaxLegacyFrameSize, false, MaxLegacyFrameSize, false},
+	}
+
+	for _, tt := range tests {
+		size, compressed := ParseFrameHeader(tt.header, tt.compression)
+		if size != tt.wantSize || compressed != tt.wantCompressed {
+			t.Errorf("%s: ParseFrameHeader(%#x, %v) = (%#x, %v), want (%#x, %v)",
+				tt.name, tt.header, tt.compression, size, compressed, tt.wantSize, tt.wantCompressed)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"short", []byte("hello")},
+		{"repetitive", bytes.Repeat([]byte{1, 2, 3, 4}, 4096)},
+		{"largest frame", bytes.Repeat([]byte{0x7F}, MaxFrameSize)},
+	}
+
+	for _, tt := range tests {
+		got, err := Decompress(Compress(tt.data), MaxFrameSize)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: decompressed %d bytes that differ from the %d bytes that were compressed", tt.name, len(got), len(tt.data))
+		}
+	}
+}
+
+func TestDecompressLimitsSize(t *testing.T) {
+	data := bytes.Repeat([]byte{0}, 1000)
+	compressed := Compress(data)
+
+	tests := []struct {
+		name    string
+		maxSize int
+		wantErr error
+	}{
+		{"below the limit", 1001, nil},
+		{"at the limit", 1000, nil},
+		{"above the limit", 999, ErrPacketTooLarge},
+		{"far above the limit", 10, ErrPacketTooLarge},
+	}
+
+	for _, tt := range tests {
+		got, err := Decompress(compressed, tt.maxSize)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Decompress returned error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !bytes.Equal(got, data) {
+			t.Errorf("%s: decompressed bytes differ from the original", tt.name)
+		}
+	}
+}
+
+func TestDecompressInvalidData(t *testing.T) {
+	_, err := Decompress([]byte{0xFF, 0xFF, 0xFF, 0xFF}, MaxFrameSize)
+	if err == nil {
+		t.Error("decompressing invalid data did not return an error")
+	}
+}
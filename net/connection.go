@@ -1,7 +1,13 @@
 package net
 
 import (
+	"errors"
+	"log"
 	tcp "net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ConnState int
@@ -17,9 +23,17 @@ type Conn struct {
 	config     *Config
 	connId     int
 	conn       tcp.Conn
+	mu         sync.Mutex
 	state      ConnState
 	send       chan []byte
 	remoteAddr string
+
+	authenticated atomic.Bool
+	idleTimeout   atomic.Int64
+	compression   atomic.Bool
+
+	queuedBytes    atomic.Int64
+	droppedPackets atomic.Int64
 }
 
 func getRemoteAddr(conn tcp.Conn) string {
@@ -34,33 +48,52 @@ func getRemoteAddr(conn tcp.Conn) string {
 }
 
 func startConnection(network *Network, connId int, conn tcp.Conn) {
+	queueSize := network.config.SendQueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultSendQueueSize
+	}
+
 	connection := &Conn{
 		network:    network,
 		config:     network.config,
 		connId:     connId,
 		conn:       conn,
 		state:      StateOpen,
-		send:       make(chan []byte),
+		send:       make(chan []byte, queueSize),
 		remoteAddr: getRemoteAddr(conn),
 	}
 
-	go connection.doReceive()
+	connection.idleTimeout.Store(int64(network.config.IdleTimeout))
+
+	network.addConnection(connection)
+
 	go connection.doSend()
 
+	// Notify the client has connected before receiving data, so data is never reported for an unknown client
 	connection.config.OnClientConnected(connId, connection)
+
+	go connection.doReceive()
 }
 
 func (conn *Conn) doReceive() {
 	defer func() {
 		_ = conn.conn.Close()
-		conn.network.disconnect <- conn
+		select {
+		case conn.network.disconnect <- conn:
+		case <-conn.network.stopped:
+		}
 	}()
 
 	buf := make([]byte, 4096)
 
 	for {
+		conn.extendReadDeadline()
+
 		bytesReceived, err := conn.conn.Read(buf)
 		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("[%d] Connection with %s has timed out\n", conn.connId, conn.remoteAddr)
+			}
 			return
 		}
 
@@ -71,13 +104,25 @@ func (conn *Conn) doReceive() {
 func (conn *Conn) doSend() {
 	defer func() {
 		_ = conn.conn.Close()
+		conn.network.senders.Done()
 	}()
 
+	failed := false
+
 	for packet := range conn.send {
+		conn.queuedBytes.Add(-int64(len(packet)))
+
+		// Keep draining the channel after a write has failed, so senders never block on a dead connection
+		if failed {
+			continue
+		}
+
 		for len(packet) > 0 {
 			sent, e := conn.conn.Write(packet)
 			if e != nil {
-				return
+				failed = true
+				_ = conn.conn.Close()
+				break
 			}
 
 			packet = packet[sent:]
@@ -85,25 +130,145 @@ func (conn *Conn) doSend() {
 	}
 }
 
+// Send queues the specified bytes to be sent to the client. It is safe to call Send from any goroutine.
+// Send never blocks; when the queue of the connection is full the slow client policy of the network is applied.
 func (conn *Conn) Send(bytes []byte) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
 	if conn.state != StateOpen {
 		return
 	}
-	conn.send <- bytes
+
+	size := int64(len(bytes))
+
+	maxBytes := int64(conn.config.MaxQueuedBytes)
+	if maxBytes <= 0 || conn.queuedBytes.Load()+size <= maxBytes {
+		// The bytes are counted before queueing, so the sender can never make the counter negative
+		conn.queuedBytes.Add(size)
+		select {
+		case conn.send <- bytes:
+			return
+		default:
+			conn.queuedBytes.Add(-size)
+		}
+	}
+
+	if conn.config.SlowClientPolicy == DropPackets {
+		conn.droppedPackets.Add(1)
+		return
+	}
+
+	log.Printf("[%d] Disconnecting %s, client is not keeping up (%d packets, %d bytes queued)\n",
+		conn.connId, conn.remoteAddr, len(conn.send), conn.queuedBytes.Load())
+
+	// Close the underlying connection right away, so the packets that are still queued are discarded
+	close(conn.send)
+	conn.state = StateClosing
+	_ = conn.conn.Close()
+}
+
+// QueuedBytes returns the number of bytes waiting to be sent to the client.
+func (conn *Conn) QueuedBytes() int64 {
+	return conn.queuedBytes.Load()
+}
+
+// Stats returns the outbound queue counters of the connection.
+func (conn *Conn) Stats() ConnStats {
+	return ConnStats{
+		Id:             conn.connId,
+		RemoteAddr:     conn.remoteAddr,
+		QueuedPackets:  len(conn.send),
+		QueuedBytes:    conn.queuedBytes.Load(),
+		DroppedPackets: conn.droppedPackets.Load(),
+	}
+}
+
+// readTimeout returns the time the connection may be idle before it is closed, or zero if it may be idle indefinitely.
+func (conn *Conn) readTimeout() time.Duration {
+	if !conn.authenticated.Load() && conn.config.LoginTimeout > 0 {
+		return conn.config.LoginTimeout
+	}
+	return time.Duration(conn.idleTimeout.Load())
+}
+
+// extendReadDeadline moves the read deadline of the connection to the current time plus the read timeout.
+func (conn *Conn) extendReadDeadline() {
+	timeout := conn.readTimeout()
+	if timeout <= 0 {
+		_ = conn.conn.SetReadDeadline(time.Time{})
+		return
+	}
+	_ = conn.conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+// Authenticate marks the connection as authenticated, so the idle timeout applies instead of the login timeout.
+// It is safe to call Authenticate from any goroutine.
+func (conn *Conn) Authenticate() {
+	if conn.authenticated.Swap(true) {
+		return
+	}
+	conn.extendReadDeadline()
+}
+
+// SetIdleTimeout changes the idle timeout of the connection, for example for clients that are known to send heartbeats.
+// A timeout of zero disables the idle timeout. It is safe to call SetIdleTimeout from any goroutine.
+func (conn *Conn) SetIdleTimeout(timeout time.Duration) {
+	conn.idleTimeout.Store(int64(timeout))
+	if conn.authenticated.Load() {
+		conn.extendReadDeadline()
+	}
+}
+
+// SetCompression sets whether the connection negotiated compression, which changes how the frames it receives are parsed.
+// It is safe to call SetCompression from any goroutine.
+func (conn *Conn) SetCompression(enabled bool) {
+	conn.compression.Store(enabled)
+}
+
+// Compression returns true if the connection negotiated compression.
+// It is safe to call Compression from any goroutine.
+func (conn *Conn) Compression() bool {
+	return conn.compression.Load()
 }
 
 func (conn *Conn) Id() int { return conn.connId }
 
-func (conn *Conn) State() ConnState { return conn.state }
+func (conn *Conn) State() ConnState {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return conn.state
+}
 
 func (conn *Conn) RemoteAddr() string {
 	return conn.remoteAddr
 }
 
+// Close closes the connection after all packets that have been queued are sent.
+// It is safe to call Close from any goroutine.
 func (conn *Conn) Close() {
-	if conn.state == StateClosed {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.state != StateOpen {
 		return
 	}
 	close(conn.send)
 	conn.state = StateClosing
 }
+
+// markClosed marks the connection as closed and returns true if it was not marked closed before.
+func (conn *Conn) markClosed() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.state == StateClosed {
+		return false
+	}
+	if conn.state == StateOpen {
+		close(conn.send)
+	}
+	conn.state = StateClosed
+	return true
+}
@@ -1,13 +1,34 @@
 package net
 
 import (
+	"errors"
 	"log"
 	tcp "net"
+	"sync"
+	"time"
 )
 
+// SlowClientPolicy decides what happens to a connection whose outbound queue is full.
+type SlowClientPolicy int
+
+const (
+	DisconnectSlowClients SlowClientPolicy = iota // The connection is closed without sending the packets that are still queued.
+	DropPackets                                   // Packets that do not fit in the queue are discarded.
+)
+
+// DefaultSendQueueSize is the number of packets that can be queued for a connection when Config.SendQueueSize is zero.
+const DefaultSendQueueSize = 256
+
 type Config struct {
 	Address              string
+	Transport            Transport // The transport to listen on; defaults to TCP when nil.
 	MaxConnections       int
+	MaxConnectionsPerIP  int              // The maximum number of simultaneous connections from a single IP address; zero means no limit.
+	IdleTimeout          time.Duration    // The time after which a connection that has not sent any data is closed; zero disables the timeout.
+	LoginTimeout         time.Duration    // The idle timeout of connections that have not been authenticated; zero uses IdleTimeout.
+	SendQueueSize        int              // The maximum number of packets queued for a connection; zero uses DefaultSendQueueSize.
+	MaxQueuedBytes       int              // The maximum number of bytes queued for a connection; zero means there is no limit.
+	SlowClientPolicy     SlowClientPolicy // What to do when a packet does not fit in the queue of a connection.
 	OnClientConnected    func(id int, conn *Conn)
 	OnClientDisconnected func(id int, conn *Conn)
 	OnDataReceived       func(id int, conn *Conn, bytes []byte)
@@ -15,10 +36,17 @@ type Config struct {
 
 type Network struct {
 	config        *Config
-	listen        tcp.Listener
+	listenersMu   sync.Mutex
+	listeners     []tcp.Listener
 	connectionIds []int
+	ipCounts      map[string]int
+	connsMu       sync.Mutex
+	conns         map[int]*Conn
+	senders       sync.WaitGroup
 	connect       chan tcp.Conn
 	disconnect    chan *Conn
+	stop          chan struct{}
+	stopped       chan struct{}
 }
 
 func (network *Network) getAvailableConnectionId() int {
@@ -33,12 +61,26 @@ func (network *Network) getAvailableConnectionId() int {
 	return id
 }
 
+func (network *Network) addConnection(conn *Conn) {
+	network.connsMu.Lock()
+	defer network.connsMu.Unlock()
+
+	network.conns[conn.connId] = conn
+	network.senders.Add(1)
+}
+
+func (network *Network) removeConnection(conn *Conn) {
+	network.connsMu.Lock()
+	defer network.connsMu.Unlock()
+
+	delete(network.conns, conn.connId)
+}
+
 func (network *Network) run() {
 	defer func() {
-		_ = network.listen.Close()
+		network.closeListeners()
 
-		close(network.connect)
-		close(network.disconnect)
+		close(network.stopped)
 
 		log.Println("Network subsystem has stopped")
 	}()
@@ -46,59 +88,178 @@ func (network *Network) run() {
 	for {
 		select {
 		case conn := <-network.connect:
+			remoteAddr := getRemoteAddr(conn)
+
+			limit := network.config.MaxConnectionsPerIP
+			if limit > 0 && network.ipCounts[remoteAddr] >= limit {
+				log.Printf("Rejected connection from %s, too many connections from the same address\n", remoteAddr)
+				_ = conn.Close()
+				break
+			}
+
 			connId := network.getAvailableConnectionId()
 			if connId == -1 {
 				_ = conn.Close()
 				break
 			}
+
+			network.ipCounts[remoteAddr]++
 			startConnection(network, connId, conn)
 
 		case conn := <-network.disconnect:
-			if conn.state == StateClosed {
+			if !conn.markClosed() {
 				break
 			}
-			conn.state = StateClosed
+			network.removeConnection(conn)
+
+			network.ipCounts[conn.remoteAddr]--
+			if network.ipCounts[conn.remoteAddr] <= 0 {
+				delete(network.ipCounts, conn.remoteAddr)
+			}
 			if conn.connId != -1 {
 				network.config.OnClientDisconnected(conn.connId, conn)
 				network.connectionIds = append(network.connectionIds, conn.connId)
 			}
+
+		case <-network.stop:
+			return
 		}
 	}
 }
 
-func Start(config Config) error {
-	listen, err := tcp.Listen("tcp", config.Address)
-	if err != nil {
-		return err
+// Start starts the network subsystem and begins accepting connections on the configured address.
+func Start(config Config) (*Network, error) {
+	transport := config.Transport
+	if transport == nil {
+		transport = TCPTransport{}
 	}
 
-	network := Network{
+	network := &Network{
 		config:        &config,
-		listen:        listen,
 		connectionIds: make([]int, config.MaxConnections),
+		ipCounts:      make(map[string]int),
+		conns:         make(map[int]*Conn),
 		connect:       make(chan tcp.Conn),
 		disconnect:    make(chan *Conn),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
 	}
 
 	for i := 0; i < config.MaxConnections; i++ {
 		network.connectionIds[i] = i
 	}
 
-	log.Println("Network subsystem has started on", config.Address)
+	err := network.Listen(transport, config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	go network.run()
+
+	return network, nil
+}
+
+// Listen begins accepting connections on the specified address using the specified transport,
+// in addition to any addresses the network is already listening on.
+func (network *Network) Listen(transport Transport, address string) error {
+	listen, err := transport.Listen(address)
+	if err != nil {
+		return err
+	}
+
+	network.listenersMu.Lock()
+	network.listeners = append(network.listeners, listen)
+	network.listenersMu.Unlock()
+
+	log.Println("Network subsystem is listening on", listen.Addr())
 
 	go func() {
 		for {
 			conn, err := listen.Accept()
 			if err != nil {
-				log.Print(err)
+				if !errors.Is(err, tcp.ErrClosed) {
+					log.Print(err)
+				}
 				break
 			}
 
-			network.connect <- conn
+			select {
+			case network.connect <- conn:
+			case <-network.stopped:
+				_ = conn.Close()
+				return
+			}
 		}
 	}()
 
-	go network.run()
-
 	return nil
 }
+
+// StopAccepting stops accepting new connections on all addresses. Existing connections are not affected.
+func (network *Network) StopAccepting() {
+	network.closeListeners()
+}
+
+// Shutdown stops accepting new connections and closes all connections once the packets queued for them have been sent.
+// It waits until all connections are closed or the timeout has elapsed, and returns false if the timeout elapsed.
+func (network *Network) Shutdown(timeout time.Duration) bool {
+	network.closeListeners()
+
+	network.connsMu.Lock()
+	for _, conn := range network.conns {
+		conn.Close()
+	}
+	network.connsMu.Unlock()
+
+	flushed := make(chan struct{})
+	go func() {
+		network.senders.Wait()
+		close(flushed)
+	}()
+
+	result := true
+	select {
+	case <-flushed:
+	case <-time.After(timeout):
+		result = false
+	}
+
+	close(network.stop)
+	<-network.stopped
+
+	return result
+}
+
+// ConnStats holds the outbound queue counters of a connection.
+type ConnStats struct {
+	Id             int
+	RemoteAddr     string
+	QueuedPackets  int
+	QueuedBytes    int64
+	DroppedPackets int64
+}
+
+// Stats returns the outbound queue counters of all open connections. It is safe to call Stats from any goroutine.
+func (network *Network) Stats() []ConnStats {
+	network.connsMu.Lock()
+	defer network.connsMu.Unlock()
+
+	result := make([]ConnStats, 0, len(network.conns))
+	for _, conn := range network.conns {
+		result = append(result, conn.Stats())
+	}
+
+	return result
+}
+
+// closeListeners stops accepting connections on all addresses.
+func (network *Network) closeListeners() {
+	network.listenersMu.Lock()
+	defer network.listenersMu.Unlock()
+
+	for _, listen := range network.listeners {
+		_ = listen.Close()
+	}
+
+	network.listeners = nil
+}
@@ -1,26 +1,67 @@
 ﻿package net
 
+import "errors"
+
+// DefaultMaxStringLength is the default maximum length of strings read by ReadString.
+const DefaultMaxStringLength = 1024
+
+var (
+	ErrUnexpectedEnd = errors.New("packet: unexpected end of packet")
+	ErrStringTooLong = errors.New("packet: string exceeds the maximum length")
+)
+
 type PacketReader struct {
-	buffer []byte
+	buffer          []byte
+	err             error
+	maxStringLength int
+	version         int
 }
 
 // NewReader returns a new packet reader whose buffer holds the specified bytes.
 func NewReader(bytes []byte) *PacketReader {
 	return &PacketReader{
-		buffer: bytes,
+		buffer:          bytes,
+		maxStringLength: DefaultMaxStringLength,
 	}
 }
 
+// SetMaxStringLength sets the maximum length of the strings that can be read by ReadString.
+func (r *PacketReader) SetMaxStringLength(length int) {
+	r.maxStringLength = length
+}
+
+// SetVersion sets the protocol version used by ReadPacket. Fields introduced in later versions are not read.
+// The default version of zero reads all fields.
+func (r *PacketReader) SetVersion(version int) {
+	r.version = version
+}
+
+// Err returns the first error that was encountered while reading, or nil if all reads were successful.
+// Once an error has occurred all subsequent reads return zero values.
+func (r *PacketReader) Err() error {
+	return r.err
+}
+
 // Read reads the specified number of bytes.
+// If there are not enough bytes left, the reader enters the error state and a slice of zero bytes is returned.
 func (r *PacketReader) Read(count int) []byte {
+	if count < 0 {
+		count = 0
+	}
+
+	if r.err != nil || count > len(r.buffer) {
+		r.fail(ErrUnexpectedEnd)
+		return make([]byte, count)
+	}
+
 	data := r.buffer[:count]
 	r.buffer = r.buffer[count:]
 	return data
 }
 
-// ReadByte reads a single byte.
-func (r *PacketReader) ReadByte() byte {
-	return r.Read(1)[0]
+// ReadByte reads a single byte. The returned error is the same as the one returned by Err.
+func (r *PacketReader) ReadByte() (byte, error) {
+	return r.Read(1)[0], r.err
 }
 
 // ReadInteger reads a 16-bit integer.
@@ -35,10 +76,30 @@ func (r *PacketReader) ReadLong() int {
 	return int(data[3])<<24 | int(data[2])<<16 | int(data[1])<<8 | int(data[0])
 }
 
-// ReadString reads a string,
+// ReadString reads a string.
+// If the string is longer than the maximum string length or the packet ends before the string does,
+// the reader enters the error state and an empty string is returned.
 func (r *PacketReader) ReadString() string {
 	length := r.ReadInteger()
-	return string(r.Read(length))
+	if length > r.maxStringLength {
+		r.fail(ErrStringTooLong)
+	}
+	if r.err != nil {
+		return ""
+	}
+	data := r.Read(length)
+	if r.err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// fail puts the reader in the error state, unless it already is in the error state.
+func (r *PacketReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.buffer = nil
 }
 
 // Remaining returns the number of bytes left to be read.
@@ -0,0 +1,118 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReadBounds(t *testing.T) {
+	tests := []struct {
+		name          string
+		buffer        []byte
+		count         int
+		want          []byte
+		wantErr       error
+		wantRemaining int
+	}{
+		{"nothing", []byte{1, 2}, 0, []byte{}, nil, 2},
+		{"part", []byte{1, 2, 3}, 2, []byte{1, 2}, nil, 1},
+		{"all", []byte{1, 2, 3}, 3, []byte{1, 2, 3}, nil, 0},
+		{"past the end", []byte{1, 2, 3}, 4, []byte{0, 0, 0, 0}, ErrUnexpectedEnd, 0},
+		{"empty buffer", nil, 1, []byte{0}, ErrUnexpectedEnd, 0},
+		{"negative count", []byte{1, 2}, -1, []byte{}, nil, 2},
+	}
+
+	for _, tt := range tests {
+		r := NewReader(tt.buffer)
+
+		got := r.Read(tt.count)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: Read(%d) = %v, want %v", tt.name, tt.count, got, tt.want)
+		}
+		if !errors.Is(r.Err(), tt.wantErr) {
+			t.Errorf("%s: Err() = %v, want %v", tt.name, r.Err(), tt.wantErr)
+		}
+		if r.Remaining() != tt.wantRemaining {
+			t.Errorf("%s: Remaining() = %d, want %d", tt.name, r.Remaining(), tt.wantRemaining)
+		}
+	}
+}
+
+func TestReadIntegers(t *testing.T) {
+	tests := []struct {
+		name    string
+		buffer  []byte
+		read    func(r *PacketReader) int
+		want    int
+		wantErr error
+	}{
+		{"integer", []byte{0x34, 0x12}, (*PacketReader).ReadInteger, 0x1234, nil},
+		{"short integer", []byte{0x34}, (*PacketReader).ReadInteger, 0, ErrUnexpectedEnd},
+		{"long", []byte{0x78, 0x56, 0x34, 0x12}, (*PacketReader).ReadLong, 0x12345678, nil},
+		{"short long", []byte{0x78, 0x56, 0x34}, (*PacketReader).ReadLong, 0, ErrUnexpectedEnd},
+	}
+
+	for _, tt := range tests {
+		r := NewReader(tt.buffer)
+
+		if got := tt.read(r); got != tt.want {
+			t.Errorf("%s: read %#x, want %#x", tt.name, got, tt.want)
+		}
+		if !errors.Is(r.Err(), tt.wantErr) {
+			t.Errorf("%s: Err() = %v, want %v", tt.name, r.Err(), tt.wantErr)
+		}
+	}
+}
+
+func TestReadString(t *testing.T) {
+	tests := []struct {
+		name      string
+		buffer    []byte
+		maxLength int
+		want      string
+		wantErr   error
+	}{
+		{"empty", []byte{0, 0}, 4, "", nil},
+		{"at the maximum length", []byte{4, 0, 't', 'e', 's', 't'}, 4, "test", nil},
+		{"too long", []byte{5, 0, 't', 'e', 's', 't', 's'}, 4, "", ErrStringTooLong},
+		{"length past the end", []byte{4, 0, 't', 'e'}, 4, "", ErrUnexpectedEnd},
+		{"missing length", []byte{4}, 4, "", ErrUnexpectedEnd},
+		{"huge length", []byte{0xFF, 0xFF}, DefaultMaxStringLength, "", ErrStringTooLong},
+	}
+
+	for _, tt := range tests {
+		r := NewReader(tt.buffer)
+		r.SetMaxStringLength(tt.maxLength)
+
+		if got := r.ReadString(); got != tt.want {
+			t.Errorf("%s: ReadString() = %q, want %q", tt.name, got, tt.want)
+		}
+		if !errors.Is(r.Err(), tt.wantErr) {
+			t.Errorf("%s: Err() = %v, want %v", tt.name, r.Err(), tt.wantErr)
+		}
+	}
+}
+
+func TestReaderErrorIsSticky(t *testing.T) {
+	r := NewReader([]byte{3, 0, 'a', 'b', 1, 2, 3, 4})
+	r.SetMaxStringLength(2)
+
+	if got := r.ReadString(); got != "" {
+		t.Errorf("ReadString() = %q for a string that is too long, want an empty string", got)
+	}
+
+	// The bytes that are left must not be read once the reader is in the error state
+	if got := r.ReadInteger(); got != 0 {
+		t.Errorf("ReadInteger() = %d after an error, want 0", got)
+	}
+	if b, err := r.ReadByte(); b != 0 || err != ErrStringTooLong {
+		t.Errorf("ReadByte() = (%d, %v) after an error, want (0, %v)", b, err, ErrStringTooLong)
+	}
+	if r.Remaining() != 0 {
+		t.Errorf("Remaining() = %d after an error, want 0", r.Remaining())
+	}
+	if r.Err() != ErrStringTooLong {
+		t.Errorf("Err() = %v, want the first error %v", r.Err(), ErrStringTooLong)
+	}
+}
@@ -1,7 +1,8 @@
 ﻿package net
 
 type PacketWriter struct {
-	buffer []byte
+	buffer  []byte
+	version int
 }
 
 // NewWriter returns a new packet Writer whose buffer has the default size.
@@ -21,6 +22,12 @@ func NewWriterSize(size int) *PacketWriter {
 	}
 }
 
+// SetVersion sets the protocol version used by WritePacket. Fields introduced in later versions are not written.
+// The default version of zero writes all fields.
+func (w *PacketWriter) SetVersion(version int) {
+	w.version = version
+}
+
 // Write writes the contents of bytes into the packet.
 func (w *PacketWriter) Write(bytes []byte) {
 	w.buffer = append(w.buffer, bytes...)
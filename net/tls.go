@@ -0,0 +1,145 @@
+package net
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	tcp "net"
+	"sync"
+)
+
+// recordTypeHandshake is the first byte sent by a client that starts a TLS handshake.
+const recordTypeHandshake = 0x16
+
+var ErrTLSRequired = errors.New("tls: client did not start a TLS handshake")
+
+// TLSTransport is a transport that secures the connections of another transport with TLS.
+// When TLS is not required, clients that do not start a TLS handshake are accepted as plaintext connections.
+type TLSTransport struct {
+	Transport Transport   // The transport to secure; defaults to TCP when nil.
+	Config    *tls.Config // The TLS configuration, which must contain at least one certificate.
+	Required  bool        // Whether plaintext clients should be rejected.
+}
+
+// LoadTLSConfig returns a TLS configuration using the certificate and key stored in the specified PEM files.
+func LoadTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Listen announces on the specified address using the underlying transport.
+func (t TLSTransport) Listen(address string) (tcp.Listener, error) {
+	if t.Config == nil {
+		return nil, errors.New("tls: missing configuration")
+	}
+
+	transport := t.Transport
+	if transport == nil {
+		transport = TCPTransport{}
+	}
+
+	listen, err := transport.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsListener{
+		Listener: listen,
+		config:   t.Config,
+		required: t.Required,
+	}, nil
+}
+
+type tlsListener struct {
+	tcp.Listener
+	config   *tls.Config
+	required bool
+}
+
+func (l *tlsListener) Accept() (tcp.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsDetectConn{
+		Conn:     conn,
+		config:   l.config,
+		required: l.required,
+	}, nil
+}
+
+// tlsDetectConn is a connection that determines whether the client uses TLS by peeking at the first byte it sends.
+// Detection happens on the first read or write, so accepting a connection never blocks.
+type tlsDetectConn struct {
+	tcp.Conn
+	config   *tls.Config
+	required bool
+	once     sync.Once
+	conn     tcp.Conn
+	err      error
+}
+
+func (c *tlsDetectConn) detect() error {
+	c.once.Do(func() {
+		var first [1]byte
+
+		_, err := io.ReadFull(c.Conn, first[:])
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		conn := &prefixConn{Conn: c.Conn, prefix: first[:]}
+		if first[0] == recordTypeHandshake {
+			c.conn = tls.Server(conn, c.config)
+			return
+		}
+
+		if c.required {
+			c.err = ErrTLSRequired
+			_ = c.Conn.Close()
+			return
+		}
+
+		c.conn = conn
+	})
+
+	return c.err
+}
+
+func (c *tlsDetectConn) Read(p []byte) (int, error) {
+	if err := c.detect(); err != nil {
+		return 0, err
+	}
+	return c.conn.Read(p)
+}
+
+func (c *tlsDetectConn) Write(p []byte) (int, error) {
+	if err := c.detect(); err != nil {
+		return 0, err
+	}
+	return c.conn.Write(p)
+}
+
+// prefixConn is a connection that returns the prefix bytes before reading from the connection itself.
+type prefixConn struct {
+	tcp.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
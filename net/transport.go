@@ -0,0 +1,150 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tcp "net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Transport creates listeners that accept incoming client connections.
+type Transport interface {
+	// Listen announces on the specified address and returns a listener that accepts connections on it.
+	Listen(address string) (tcp.Listener, error)
+}
+
+// TCPTransport is a transport that accepts connections over TCP.
+type TCPTransport struct {
+	KeepAlive time.Duration // The interval between TCP keep-alive probes; zero uses the system default and a negative value disables them.
+}
+
+// Listen announces on the specified TCP address.
+func (t TCPTransport) Listen(address string) (tcp.Listener, error) {
+	config := tcp.ListenConfig{KeepAlive: t.KeepAlive}
+	return config.Listen(context.Background(), "tcp", address)
+}
+
+// MemoryTransport is a transport that connects clients to the server through in-memory pipes.
+// It is primarily intended for running the server without opening any sockets, for example in tests.
+type MemoryTransport struct {
+	mu         sync.Mutex
+	listeners  map[string]*memoryListener
+	nextClient int
+}
+
+// NewMemoryTransport returns a new in-memory transport.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		listeners: make(map[string]*memoryListener),
+	}
+}
+
+// Listen announces on the specified address. The address only has to be unique within the transport.
+func (t *MemoryTransport) Listen(address string) (tcp.Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.listeners[address]; ok {
+		return nil, fmt.Errorf("memory transport: address %s already in use", address)
+	}
+
+	listener := &memoryListener{
+		transport: t,
+		addr:      memoryAddr(address),
+		accept:    make(chan tcp.Conn),
+		closed:    make(chan struct{}),
+	}
+
+	t.listeners[address] = listener
+
+	return listener, nil
+}
+
+// Dial connects to the listener on the specified address and returns the client side of the connection.
+// Every client gets a host of its own, so clients are not subject to the limit on connections from the same address.
+// Note that the connection is synchronous; writes block until the other side has read the data.
+func (t *MemoryTransport) Dial(address string) (tcp.Conn, error) {
+	return t.DialFrom(address, "")
+}
+
+// DialFrom is like Dial, but the client connects from the specified host.
+// Clients that connect from the same host count towards the same limit on connections from the same address.
+// An empty host gives the client a host of its own.
+func (t *MemoryTransport) DialFrom(address string, host string) (tcp.Conn, error) {
+	t.mu.Lock()
+	listener, ok := t.listeners[address]
+	t.nextClient++
+	if host == "" {
+		host = fmt.Sprintf("client%d", t.nextClient)
+	}
+	clientAddr := memoryAddr(tcp.JoinHostPort(host, strconv.Itoa(t.nextClient)))
+	t.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("memory transport: no listener on address %s", address)
+	}
+
+	serverConn, clientConn := tcp.Pipe()
+
+	select {
+	case listener.accept <- &memoryConn{Conn: serverConn, local: listener.addr, remote: clientAddr}:
+		return &memoryConn{Conn: clientConn, local: clientAddr, remote: listener.addr}, nil
+	case <-listener.closed:
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+		return nil, tcp.ErrClosed
+	}
+}
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+
+func (a memoryAddr) String() string { return string(a) }
+
+type memoryConn struct {
+	tcp.Conn
+	local  tcp.Addr
+	remote tcp.Addr
+}
+
+func (c *memoryConn) LocalAddr() tcp.Addr { return c.local }
+
+func (c *memoryConn) RemoteAddr() tcp.Addr { return c.remote }
+
+type memoryListener struct {
+	transport *MemoryTransport
+	addr      memoryAddr
+	accept    chan tcp.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (tcp.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.closed:
+		return nil, tcp.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	err := errors.New("memory transport: listener already closed")
+
+	l.closeOnce.Do(func() {
+		l.transport.mu.Lock()
+		delete(l.transport.listeners, string(l.addr))
+		l.transport.mu.Unlock()
+
+		close(l.closed)
+		err = nil
+	})
+
+	return err
+}
+
+func (l *memoryListener) Addr() tcp.Addr { return l.addr }
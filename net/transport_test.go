@@ -0,0 +1,100 @@
+package net
+
+import (
+	"io"
+	tcp "net"
+	"testing"
+	"time"
+)
+
+func TestMemoryTransportConnectionsPerIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		hosts     []string
+		connected int
+	}{
+		{"own hosts", []string{"", "", "", ""}, 4},
+		{"same host", []string{"shared", "shared", "shared", "shared"}, 2},
+		{"two hosts", []string{"a", "b", "a", "b", "a"}, 4},
+	}
+
+	for _, tt := range tests {
+		transport := NewMemoryTransport()
+		connected := make(chan int, len(tt.hosts))
+
+		network, err := Start(Config{
+			Address:              "game",
+			Transport:            transport,
+			MaxConnections:       len(tt.hosts),
+			MaxConnectionsPerIP:  2,
+			OnClientConnected:    func(id int, conn *Conn) { connected <- id },
+			OnClientDisconnected: func(id int, conn *Conn) {},
+			OnDataReceived:       func(id int, conn *Conn, bytes []byte) {},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clients := make([]tcp.Conn, 0, len(tt.hosts))
+		for _, host := range tt.hosts {
+			client, err := transport.DialFrom("game", host)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			clients = append(clients, client)
+		}
+
+		// Rejected clients are disconnected right away, so waiting for them keeps the count from racing
+		rejected := 0
+		for _, client := range clients {
+			_ = client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if _, err := client.Read(make([]byte, 1)); err == io.EOF {
+				rejected++
+			}
+		}
+
+		if got := len(tt.hosts) - rejected; got != tt.connected || len(connected) != tt.connected {
+			t.Errorf("%s: %d clients connected (%d callbacks), want %d", tt.name, got, len(connected), tt.connected)
+		}
+
+		for _, client := range clients {
+			_ = client.Close()
+		}
+		if !network.Shutdown(time.Second) {
+			t.Errorf("%s: shutdown timed out", tt.name)
+		}
+	}
+}
+
+func TestMemoryTransportAddresses(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	listener, err := transport.Listen("game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if _, err := transport.Listen("game"); err == nil {
+		t.Errorf("listening twice on the same address succeeded")
+	}
+	if _, err := transport.Dial("elsewhere"); err == nil {
+		t.Errorf("dialing an address without a listener succeeded")
+	}
+
+	hosts := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		go func() { _, _ = transport.Dial("game") }()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		host := getRemoteAddr(conn)
+		if host == "unknown" || hosts[host] {
+			t.Errorf("client %d has host %q, which is not unique", i, host)
+		}
+		hosts[host] = true
+	}
+}
@@ -0,0 +1,391 @@
+package net
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	tcp "net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const websocketGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+const (
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+)
+
+var errWebSocketProtocol = errors.New("websocket: protocol error")
+
+// WebSocketTransport is a transport that accepts WebSocket connections.
+// Packets are carried in binary messages using the same framing as the TCP transport.
+type WebSocketTransport struct {
+	Transport   Transport                  // The transport that carries the HTTP connections; defaults to TCP when nil.
+	Path        string                     // The HTTP path on which WebSocket connections are accepted; defaults to "/".
+	CheckOrigin func(r *http.Request) bool // Decides whether a request from the origin is allowed; defaults to SameOrigin.
+}
+
+// SameOrigin returns true if the request was made by a page on the host that serves the WebSocket endpoint.
+// Requests without an Origin header are allowed, as browsers always send one; they come from other clients.
+// Without this check, any web page could connect to the server from the browser of someone visiting it.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// AllowOrigins returns a function for CheckOrigin that allows requests from the same origin
+// and from the specified origins, like "https://play.example.com".
+func AllowOrigins(origins ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		if SameOrigin(r) {
+			return true
+		}
+
+		origin := r.Header.Get("Origin")
+
+		return slices.ContainsFunc(origins, func(allowed string) bool {
+			return strings.EqualFold(allowed, origin)
+		})
+	}
+}
+
+// Listen announces on the specified address and serves the WebSocket endpoint on it.
+func (t WebSocketTransport) Listen(address string) (tcp.Listener, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = TCPTransport{}
+	}
+
+	listen, err := transport.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	path := t.Path
+	if path == "" {
+		path = "/"
+	}
+
+	listener := &wsListener{
+		addr:   listen.Addr(),
+		accept: make(chan tcp.Conn),
+		closed: make(chan struct{}),
+	}
+
+	checkOrigin := t.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if !checkOrigin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		listener.upgrade(w, r)
+	})
+
+	listener.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := listener.server.Serve(listen)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Print(err)
+		}
+	}()
+
+	return listener, nil
+}
+
+type wsListener struct {
+	addr      tcp.Addr
+	server    *http.Server
+	accept    chan tcp.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *wsListener) Accept() (tcp.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.closed:
+		return nil, tcp.ErrClosed
+	}
+}
+
+func (l *wsListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.server.Close()
+	})
+	return err
+}
+
+func (l *wsListener) Addr() tcp.Addr { return l.addr }
+
+// headerContainsToken returns true if the comma separated header value contains the specified token.
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgrade performs the WebSocket opening handshake and hands the connection to the listener.
+func (l *wsListener) upgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Upgrade Required", http.StatusUpgradeRequired)
+		return
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGuid))
+
+	_, err = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"))
+
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	ws := &wsConn{
+		Conn:   conn,
+		reader: rw.Reader,
+	}
+
+	select {
+	case l.accept <- ws:
+	case <-l.closed:
+		_ = ws.Close()
+	}
+}
+
+// wsConn adapts a WebSocket connection to a byte stream.
+// The payloads of all data frames received are returned by Read in order, and every Write is sent as a single binary message.
+type wsConn struct {
+	tcp.Conn
+	reader    *bufio.Reader
+	writeMu   sync.Mutex
+	closeSent bool
+	remaining uint64
+	mask      [4]byte
+	maskPos   int
+	closeOnce sync.Once
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		err := c.readFrameHeader()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	n, err := c.reader.Read(p)
+	c.unmask(p[:n])
+	c.remaining -= uint64(n)
+
+	return n, err
+}
+
+// readFrameHeader reads frame headers until the start of a data frame is found, handling any control frames along the way.
+func (c *wsConn) readFrameHeader() error {
+	var header [2]byte
+	_, err := io.ReadFull(c.reader, header[:])
+	if err != nil {
+		return err
+	}
+
+	final := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	// Frames sent by clients must always be masked
+	if !masked || header[0]&0x70 != 0 {
+		return c.fail(wsCloseProtocol)
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if _, err := io.ReadFull(c.reader, c.mask[:]); err != nil {
+		return err
+	}
+	c.maskPos = 0
+
+	switch opcode {
+	case wsOpBinary, wsOpContinuation:
+		c.remaining = length
+		return nil
+
+	case wsOpText:
+		return c.fail(wsCloseUnsupported)
+
+	case wsOpClose, wsOpPing, wsOpPong:
+		if !final || length > 125 {
+			return c.fail(wsCloseProtocol)
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return err
+		}
+		c.unmask(payload)
+
+		if opcode == wsOpClose {
+			_ = c.writeFrame(wsOpClose, payload)
+			return io.EOF
+		}
+
+		if opcode == wsOpPing {
+			return c.writeFrame(wsOpPong, payload)
+		}
+
+		return nil
+	}
+
+	return c.fail(wsCloseProtocol)
+}
+
+func (c *wsConn) unmask(p []byte) {
+	for i := range p {
+		p[i] ^= c.mask[c.maskPos&3]
+		c.maskPos++
+	}
+}
+
+// fail sends a close frame with the specified status code and returns a protocol error.
+func (c *wsConn) fail(code int) error {
+	_ = c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, uint16(code)))
+	return errWebSocketProtocol
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	frame = append(frame, payload...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// Nothing may be sent after the close frame
+	if c.closeSent {
+		return tcp.ErrClosed
+	}
+	c.closeSent = opcode == wsOpClose
+
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	err := c.writeFrame(wsOpBinary, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		_ = c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+		err = c.Conn.Close()
+	})
+	return err
+}
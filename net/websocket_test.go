@@ -0,0 +1,96 @@
+package net
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowOrigins := AllowOrigins("https://play.example.com")
+
+	tests := []struct {
+		name         string
+		origin       string
+		sameOrigin   bool
+		allowOrigins bool
+	}{
+		{"no origin", "", true, true},
+		{"same origin", "http://game.example.com", true, true},
+		{"same origin with other case", "http://GAME.example.com", true, true},
+		{"other origin", "https://evil.example.com", false, false},
+		{"other port", "http://game.example.com:8080", false, false},
+		{"allowed origin", "https://play.example.com", false, true},
+		{"allowed origin with other scheme", "http://play.example.com", false, false},
+		{"invalid origin", "://", false, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://game.example.com/", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+
+		if got := SameOrigin(r); got != tt.sameOrigin {
+			t.Errorf("%s: SameOrigin = %v, want %v", tt.name, got, tt.sameOrigin)
+		}
+		if got := allowOrigins(r); got != tt.allowOrigins {
+			t.Errorf("%s: AllowOrigins = %v, want %v", tt.name, got, tt.allowOrigins)
+		}
+	}
+}
+
+func TestWebSocketRejectsOtherOrigins(t *testing.T) {
+	memory := NewMemoryTransport()
+
+	listener, err := WebSocketTransport{Transport: memory}.Listen("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{"same origin", "http://web", http.StatusSwitchingProtocols},
+		{"other origin", "https://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		conn, err := memory.Dial("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The listener must accept the connection, or the upgrade blocks
+		go func() {
+			if accepted, err := listener.Accept(); err == nil {
+				_ = accepted.Close()
+			}
+		}()
+
+		go func() {
+			_, _ = conn.Write([]byte("GET / HTTP/1.1\r\n" +
+				"Host: web\r\n" +
+				"Origin: " + tt.origin + "\r\n" +
+				"Connection: Upgrade\r\n" +
+				"Upgrade: websocket\r\n" +
+				"Sec-WebSocket-Version: 13\r\n" +
+				"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+		}()
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_ = resp.Body.Close()
+		_ = conn.Close()
+
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
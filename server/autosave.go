@@ -0,0 +1,156 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/guthius/mirage-nova/server/character"
+	"github.com/guthius/mirage-nova/server/data"
+	"github.com/guthius/mirage-nova/server/database"
+)
+
+var (
+	autosaveCount      = expvar.NewInt("autosave_count")
+	autosaveFailures   = expvar.NewInt("autosave_failures")
+	autosaveCharacters = expvar.NewInt("autosave_last_characters")
+	autosaveDuration   = expvar.NewFloat("autosave_last_duration_ms")
+)
+
+// lastSave is closed once the most recently queued save has been written to the database.
+// Every save waits for the save queued before it, so saves are written in the order in which they were taken
+// and an autosave that is still running can not overwrite the progress that was saved when a player left the game.
+// It is only accessed from the game loop.
+var lastSave = closedChannel()
+
+// saves counts the saves that have not been written yet.
+var saves sync.WaitGroup
+
+// saveErr is the first error of a save that is not repeated by a later save.
+var (
+	saveErrMutex sync.Mutex
+	saveErr      error
+)
+
+// autosaving is set while an autosave has not been written yet.
+var autosaving atomic.Bool
+
+func closedChannel() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// Autosave takes a snapshot of all characters in game and writes them to the database in the background.
+// Game content that was modified but could not be saved is saved again as well.
+// It is called periodically from the game loop.
+func Autosave(now int64) {
+	data.SaveDirty()
+
+	if autosaving.Load() {
+		log.Println("Skipping autosave, the previous autosave has not finished yet")
+		return
+	}
+
+	characters := snapshotCharacters()
+	if len(characters) == 0 {
+		return
+	}
+
+	autosaving.Store(true)
+
+	queueSave(characters, func(err error, elapsed time.Duration) {
+		autosaving.Store(false)
+
+		autosaveCount.Add(1)
+		autosaveCharacters.Set(int64(len(characters)))
+		autosaveDuration.Set(float64(elapsed.Microseconds()) / 1000)
+
+		if err != nil {
+			autosaveFailures.Add(1)
+			log.Printf("Autosave of %d characters failed after %s (%s)\n", len(characters), elapsed, err)
+			return
+		}
+
+		log.Printf("Autosaved %d characters in %s\n", len(characters), elapsed)
+	})
+}
+
+// snapshotCharacters returns copies of all characters in game.
+// The copies are taken on the game loop, so saving them in the background does not race with gameplay.
+func snapshotCharacters() []*character.Character {
+	players := GetPlayersInGame()
+	characters := make([]*character.Character, 0, len(players))
+	for _, player := range players {
+		snapshot := *player.Character
+		characters = append(characters, &snapshot)
+	}
+	return characters
+}
+
+// queueSave writes the characters to the database in a single transaction in the background,
+// once all previously queued saves have been written. The characters must not be modified afterwards.
+// When any of the characters can not be saved, none of them are. When done is not nil, it is called
+// from the background with the result of the save, otherwise failures are logged. It must be called from the game loop.
+func queueSave(characters []*character.Character, done func(err error, elapsed time.Duration)) {
+	previous := lastSave
+	finished := make(chan struct{})
+	lastSave = finished
+
+	saves.Add(1)
+
+	go func() {
+		defer saves.Done()
+		defer close(finished)
+
+		<-previous
+
+		start := time.Now()
+
+		err := saveCharacters(characters)
+
+		if done != nil {
+			done(err, time.Since(start))
+		} else if err != nil {
+			log.Printf("Failed to save %d characters (%s)\n", len(characters), err)
+		}
+	}()
+}
+
+func saveCharacters(characters []*character.Character) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	return characterStore.SaveAll(ctx, characters)
+}
+
+// pendingSaves returns a channel that is closed once all saves that have been queued so far are written.
+// Background work that loads characters waits for it, so it does not load progress that has not been saved yet.
+// It must be called from the game loop.
+func pendingSaves() <-chan struct{} {
+	return lastSave
+}
+
+// recordSaveError keeps the error of a failed save to be returned by WaitForSaves, unless an earlier error was kept.
+// Failed autosaves are not recorded, as their characters are saved again by the next autosave or when they leave.
+func recordSaveError(err error) {
+	saveErrMutex.Lock()
+	defer saveErrMutex.Unlock()
+
+	if saveErr == nil {
+		saveErr = err
+	}
+}
+
+// WaitForSaves blocks until all queued saves have been written to the database.
+// It returns the first error of the saves of characters that left the game and of the shutdown save, if any failed.
+func WaitForSaves() error {
+	saves.Wait()
+
+	saveErrMutex.Lock()
+	defer saveErrMutex.Unlock()
+
+	return saveErr
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/guthius/mirage-nova/server/character"
+	"github.com/guthius/mirage-nova/server/database"
+	"github.com/guthius/mirage-nova/server/user"
+)
+
+// runOnGameLoop runs the function on the game loop of the test server and waits for it to return.
+func runOnGameLoop(f func()) {
+	done := make(chan struct{})
+	QueueEvent(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+// testAccountId is the ID of the last account the test characters were created for.
+// The accounts do not exist, which the character store does not check.
+var testAccountId int64 = 1000
+
+func createTestCharacter(t *testing.T, accountId int64) *character.Character {
+	t.Helper()
+
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	c := character.NewCharacter(accountId, uniqueName("Saved"), character.GenderMale, 0)
+	if !characterStore.CreateCharacter(ctx, c) {
+		t.Fatal("the character could not be created")
+	}
+	return c
+}
+
+func loadTestCharacter(t *testing.T, accountId int64) character.Character {
+	t.Helper()
+
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	characters := characterStore.LoadCharactersForAccount(ctx, accountId)
+	if len(characters) != 1 {
+		t.Fatalf("account %d has %d characters, want 1", accountId, len(characters))
+	}
+	return characters[0]
+}
+
+func TestQueuedSavesAreWrittenInOrder(t *testing.T) {
+	testAccountId++
+	accountId := testAccountId
+
+	c := createTestCharacter(t, accountId)
+
+	var saved <-chan struct{}
+	runOnGameLoop(func() {
+		for x := 1; x <= 20; x++ {
+			snapshot := *c
+			snapshot.X = x
+			queueSave([]*character.Character{&snapshot}, nil)
+		}
+		saved = pendingSaves()
+	})
+
+	select {
+	case <-saved:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the saves")
+	}
+
+	if got := loadTestCharacter(t, accountId).X; got != 20 {
+		t.Errorf("the character was saved at x %d, want the last saved x 20", got)
+	}
+}
+
+// queueSaveAndWait queues a save of the characters and returns its result.
+func queueSaveAndWait(t *testing.T, characters ...*character.Character) error {
+	t.Helper()
+
+	result := make(chan error, 1)
+	runOnGameLoop(func() {
+		queueSave(characters, func(err error, elapsed time.Duration) {
+			result <- err
+		})
+	})
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the save")
+		return nil
+	}
+}
+
+func TestQueuedSaveIsOneTransaction(t *testing.T) {
+	testAccountId++
+	first := testAccountId
+	testAccountId++
+	second := testAccountId
+
+	a := *createTestCharacter(t, first)
+	b := *createTestCharacter(t, second)
+	a.Level = 7
+	b.Level = 8
+
+	notCreated := character.NewCharacter(first, uniqueName("Unsaved"), character.GenderMale, 0)
+
+	if err := queueSaveAndWait(t, &a, notCreated, &b); !errors.Is(err, character.ErrNotCreated) {
+		t.Errorf("the save returned error %v, want %v", err, character.ErrNotCreated)
+	}
+	if got := loadTestCharacter(t, first).Level; got != 1 {
+		t.Errorf("a character of a failed save was saved with level %d, want it unchanged", got)
+	}
+
+	if err := queueSaveAndWait(t, &a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadTestCharacter(t, first).Level; got != 7 {
+		t.Errorf("the first character was saved with level %d, want 7", got)
+	}
+	if got := loadTestCharacter(t, second).Level; got != 8 {
+		t.Errorf("the second character was saved with level %d, want 8", got)
+	}
+}
+
+func TestLeftGameReturnsSaveError(t *testing.T) {
+	testAccountId++
+	accountId := testAccountId
+
+	created := createTestCharacter(t, accountId)
+	created.Level = 9
+
+	tests := []struct {
+		name      string
+		character *character.Character
+		wantErr   error
+	}{
+		{"saved", created, nil},
+		{"not created", character.NewCharacter(accountId, uniqueName("Unsaved"), character.GenderMale, 0), character.ErrNotCreated},
+	}
+
+	t.Cleanup(func() {
+		saveErrMutex.Lock()
+		saveErr = nil
+		saveErrMutex.Unlock()
+	})
+
+	for _, tt := range tests {
+		player := &PlayerData{
+			Id:        -1,
+			Account:   &user.Account{Name: "test"},
+			Character: tt.character,
+		}
+
+		var saved <-chan error
+		runOnGameLoop(func() {
+			PlayersOnline++
+			saved = LeftGame(player)
+		})
+
+		select {
+		case err := <-saved:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: LeftGame returned error %v, want %v", tt.name, err, tt.wantErr)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: timed out waiting for the save", tt.name)
+		}
+	}
+
+	if got := loadTestCharacter(t, accountId).Level; got != 9 {
+		t.Errorf("the character was saved with level %d, want 9", got)
+	}
+
+	if err := WaitForSaves(); !errors.Is(err, character.ErrNotCreated) {
+		t.Errorf("WaitForSaves returned error %v, want %v", err, character.ErrNotCreated)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/guthius/mirage-nova/server/color"
 	"github.com/guthius/mirage-nova/server/config"
@@ -13,7 +15,7 @@ import (
 
 // IsBanned checks if a player is banned
 func IsBanned(ipAddr string) bool {
-	file, err := os.OpenFile("banlist.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := os.Open("banlist.txt")
 	if err != nil {
 		if !os.IsNotExist(err) {
 			log.Printf("failed to open banlist.txt (%s)", err)
@@ -23,9 +25,22 @@ func IsBanned(ipAddr string) bool {
 
 	defer file.Close()
 
+	now := time.Now().Unix()
+
+	// Each line holds the banned address, who banned it and optionally the time at which the ban expires
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), ipAddr) {
+		fields := strings.Split(scanner.Text(), ";")
+		if fields[0] != ipAddr {
+			continue
+		}
+
+		if len(fields) < 3 {
+			return true
+		}
+
+		expires, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || expires == 0 || expires > now {
 			return true
 		}
 	}
@@ -65,6 +80,11 @@ func BanPlayer(p *PlayerData) {
 
 // BanIP bans an IP address from the server
 func BanIP(ipAddr string, bannedBy string) bool {
+	return BanIPFor(ipAddr, bannedBy, 0)
+}
+
+// BanIPFor bans an IP address from the server for the specified duration. A duration of zero bans the address permanently.
+func BanIPFor(ipAddr string, bannedBy string, duration time.Duration) bool {
 	if IsBanned(ipAddr) {
 		return false
 	}
@@ -77,7 +97,11 @@ func BanIP(ipAddr string, bannedBy string) bool {
 
 	defer file.Close()
 
-	_, err = fmt.Fprintf(file, "%s;%s\n", ipAddr, bannedBy)
+	if duration > 0 {
+		_, err = fmt.Fprintf(file, "%s;%s;%d\n", ipAddr, bannedBy, time.Now().Add(duration).Unix())
+	} else {
+		_, err = fmt.Fprintf(file, "%s;%s\n", ipAddr, bannedBy)
+	}
 	if err != nil {
 		log.Printf("failed to write to banlist.txt (%s)", err)
 		return false
@@ -1,8 +1,8 @@
 package character
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"log"
 
@@ -12,9 +12,8 @@ import (
 	"github.com/guthius/mirage-nova/server/data/equipment"
 	"github.com/guthius/mirage-nova/server/data/stats"
 	"github.com/guthius/mirage-nova/server/data/vitals"
+	"github.com/guthius/mirage-nova/server/database"
 	"github.com/guthius/mirage-nova/server/utils"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type Gender int
@@ -65,73 +64,68 @@ type Character struct {
 	Dir         common.Direction
 }
 
-func init() {
-	db, err := openDatabase()
+// Store provides access to the characters stored in a database.
+type Store struct {
+	db              *sql.DB
+	statements      *database.Statements
+	exists          *sql.Stmt
+	loadForAccount  *sql.Stmt
+	loadInventory   *sql.Stmt
+	loadSpells      *sql.Stmt
+	create          *sql.Stmt
+	save            *sql.Stmt
+	deleteInventory *sql.Stmt
+	insertInventory *sql.Stmt
+	deleteSpells    *sql.Stmt
+	insertSpells    *sql.Stmt
+	delete          *sql.Stmt
+}
+
+// NewStore prepares the statements used by the store. The schema of the database must be up to date with Migrations.
+// The database must remain open for as long as the store is used.
+func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
+	statements := database.NewStatements(db)
+
+	store := &Store{
+		db:              db,
+		statements:      statements,
+		exists:          statements.Prepare(ctx, "SELECT COUNT(id) FROM characters WHERE name = ?"),
+		loadForAccount:  statements.Prepare(ctx, loadQuery),
+		loadInventory:   statements.Prepare(ctx, "SELECT slot, item, value, dur FROM character_inventory WHERE character_id = ?"),
+		loadSpells:      statements.Prepare(ctx, "SELECT slot, spell FROM character_spells WHERE character_id = ?"),
+		create:          statements.Prepare(ctx, createQuery),
+		save:            statements.Prepare(ctx, saveQuery),
+		deleteInventory: statements.Prepare(ctx, "DELETE FROM character_inventory WHERE character_id = ?"),
+		insertInventory: statements.Prepare(ctx, "INSERT INTO character_inventory (character_id, slot, item, value, dur) VALUES (?, ?, ?, ?, ?)"),
+		deleteSpells:    statements.Prepare(ctx, "DELETE FROM character_spells WHERE character_id = ?"),
+		insertSpells:    statements.Prepare(ctx, "INSERT INTO character_spells (character_id, slot, spell) VALUES (?, ?, ?)"),
+		delete:          statements.Prepare(ctx, "DELETE FROM characters WHERE id = ?"),
+	}
+
+	err := statements.Err()
 	if err != nil {
-		log.Fatal(err)
+		_ = statements.Close()
+		return nil, err
 	}
 
-	defer db.Close()
-
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS characters (
-		    id INTEGER PRIMARY KEY AUTOINCREMENT,
-		    account_id INTEGER,
-		    name TEXT UNIQUE COLLATE NOCASE,
-		    gender INTEGER NOT NULL DEFAULT 0,
-		    class INTEGER NOT NULL,
-		    sprite INTEGER NOT NULL DEFAULT 0,
-		    level INTEGER NOT NULL DEFAULT 1,
-		    exp INTEGER NOT NULL DEFAULT 0,
-		    access INTEGER NOT NULL DEFAULT 0,
-		    pk INTEGER NOT NULL DEFAULT 0,
-		    guild TEXT NOT NULL COLLATE NOCASE DEFAULT '',
-		    guild_access INTEGER NOT NULL DEFAULT 0,
-		    vital_hp INTEGER NOT NULL,
-		    vital_mp INTEGER NOT NULL,
-		    vital_sp INTEGER NOT NULL,
-		    stat_strength INTEGER NOT NULL,
-		    stat_defense INTEGER NOT NULL,
-		    stat_speed INTEGER NOT NULL,
-		    stat_magic INTEGER NOT NULL,
-		    equip_weapon INTEGER NOT NULL DEFAULT -1,
-		    equip_armor INTEGER NOT NULL DEFAULT -1,
-		    equip_helmet INTEGER NOT NULL DEFAULT -1,
-		    equip_shield INTEGER NOT NULL DEFAULT -1,
-		    inventory TEXT NOT NULL DEFAULT '',
-		    spells TEXT NOT NULL DEFAULT '',
-		    room INTEGER NOT NULL DEFAULT 0, 
-		    x INTEGER NOT NULL DEFAULT 0, 
-		    y INTEGER NOT NULL DEFAULT 0,
-		    dir INTEGER NOT NULL DEFAULT 0
-		)`)
+	return store, nil
+}
 
-	if err != nil {
-		log.Panic(err)
-	}
+// Close closes the prepared statements of the store. It does not close the database.
+func (s *Store) Close() error {
+	return s.statements.Close()
 }
 
-func Exists(characterName string) bool {
+func (s *Store) Exists(ctx context.Context, characterName string) bool {
 	if !utils.IsValidName(characterName) {
 		return false
 	}
 
-	db, err := openDatabase()
-	if err != nil {
-		return false
-	}
-
-	stmt, err := db.Prepare("SELECT COUNT(id) FROM characters WHERE name = ?")
-	if err != nil {
-		return false
-	}
-
-	defer stmt.Close()
-
-	row := stmt.QueryRow(characterName)
+	row := s.exists.QueryRowContext(ctx, characterName)
 
 	var count int64
 
-	err = row.Scan(&count)
+	err := row.Scan(&count)
 	if err != nil {
 		return false
 	}
@@ -139,54 +133,10 @@ func Exists(characterName string) bool {
 	return count == 1
 }
 
-func decodeInventoryFromJson(inventoryJson string) [config.MaxInventory]InventorySlot {
-	var slots [config.MaxInventory]InventorySlot
-
-	for i := 0; i < config.MaxInventory; i++ {
-		slots[i].Item = -1
-		slots[i].Value = 0
-		slots[i].Dur = 0
-	}
-
-	err := json.Unmarshal([]byte(inventoryJson), &slots)
-	if err != nil {
-		log.Printf("error decoding inventory (%s)\n", err)
-		return slots
-	}
-
-	return slots
-}
-
-func decodeSpellsFromJson(spellsJson string) [config.MaxCharacterSpells]int {
-	var spells [config.MaxCharacterSpells]int
-
-	err := json.Unmarshal([]byte(spellsJson), &spells)
-	if err != nil {
-		log.Printf("error decoding spells (%s)\n", err)
-		return spells
-	}
-
-	return spells
-}
-
-func LoadCharactersForAccount(accountId int64) []Character {
+func (s *Store) LoadCharactersForAccount(ctx context.Context, accountId int64) []Character {
 	characters := make([]Character, 0)
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Printf("error loading characters for account %d (%s)\n", accountId, err)
-		return characters
-	}
-
-	stmt, err := db.Prepare("SELECT * FROM characters WHERE account_id = ?")
-	if err != nil {
-		log.Printf("error loading characters for account %d (%s)\n", accountId, err)
-		return characters
-	}
-
-	defer stmt.Close()
-
-	rows, err := stmt.Query(accountId)
+	rows, err := s.loadForAccount.QueryContext(ctx, accountId)
 
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
@@ -197,9 +147,6 @@ func LoadCharactersForAccount(accountId int64) []Character {
 
 	defer rows.Close()
 
-	var characterInventory string
-	var characterSpells string
-
 	for rows.Next() {
 		var character Character
 
@@ -227,16 +174,11 @@ func LoadCharactersForAccount(accountId int64) []Character {
 			&character.Equipment.Armor,
 			&character.Equipment.Helmet,
 			&character.Equipment.Shield,
-			&characterInventory,
-			&characterSpells,
 			&character.Room,
 			&character.X,
 			&character.Y,
 			&character.Dir)
 
-		character.Inv = decodeInventoryFromJson(characterInventory)
-		character.Spells = decodeSpellsFromJson(characterSpells)
-
 		if err != nil {
 			log.Printf("error loading characters for account %d (%s)\n", accountId, err)
 			continue
@@ -245,7 +187,24 @@ func LoadCharactersForAccount(accountId int64) []Character {
 		characters = append(characters, character)
 	}
 
-	return characters
+	err = rows.Close()
+	if err != nil {
+		log.Printf("error loading characters for account %d (%s)\n", accountId, err)
+	}
+
+	// Characters without their inventory or spells are left out, so they can not be saved over with nothing
+	loaded := characters[:0]
+	for _, character := range characters {
+		err = s.loadItems(ctx, &character)
+		if err != nil {
+			log.Printf("error loading inventory and spells of character %d (%s)\n", character.Id, err)
+			continue
+		}
+
+		loaded = append(loaded, character)
+	}
+
+	return loaded
 }
 
 func (c *Character) Clear() {
@@ -289,38 +248,27 @@ func (c *Character) ClearSpells() {
 	}
 }
 
-func encodeInventoryAsJson(inventory [config.MaxInventory]InventorySlot) string {
-	bytes, err := json.Marshal(inventory)
-	if err != nil {
-		log.Printf("error encoding inventory (%s)\n", err)
-		return ""
-	}
-
-	return string(bytes)
-}
-
-func encodeSpellsAsJson(spells [config.MaxCharacterSpells]int) string {
-	bytes, err := json.Marshal(spells)
-	if err != nil {
-		log.Printf("error encoding spells (%s)\n", err)
-		return ""
-	}
-
-	return string(bytes)
-}
+// ErrNotCreated is returned by Save and SaveAll when the character has not been stored in the database yet.
+var ErrNotCreated = errors.New("character: character has not been created")
 
-func (c *Character) Save() bool {
-	if c == nil || c.Id == 0 {
-		return false
-	}
+const loadQuery = `
+		SELECT
+		    id, account_id, name, gender, class, sprite, level, exp, access, pk, guild, guild_access,
+		    vital_hp, vital_mp, vital_sp,
+		    stat_strength, stat_defense, stat_speed, stat_magic,
+		    equip_weapon, equip_armor, equip_helmet, equip_shield,
+		    room, x, y, dir
+		FROM characters
+		WHERE account_id = ?`
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Fatal(err)
-		return false
-	}
+const createQuery = `INSERT INTO characters 
+    	(account_id, name, gender, class, sprite, level, exp, access, pk,
+    	 vital_hp, vital_mp, vital_sp, 
+    	 stat_strength, stat_defense, stat_speed, stat_magic,
+    	 room, x, y, dir) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	stmt, err := db.Prepare(`
+const saveQuery = `
 		UPDATE characters 
 		SET 
 		    gender = ?, 
@@ -343,69 +291,50 @@ func (c *Character) Save() bool {
 		    equip_armor = ?,
 		    equip_helmet = ?,
 		    equip_shield = ?,
-		    inventory = ?,
-		    spells = ?,
 		    room = ?,
 		    x = ?,
 		    y = ?,
 		    dir = ?
-		WHERE id = ?`)
+		WHERE id = ?`
 
-	if err != nil {
-		return false
+// Save writes the character, its inventory and its spells back to the database in a single transaction.
+func (s *Store) Save(ctx context.Context, c *Character) error {
+	if c == nil {
+		return ErrNotCreated
 	}
 
-	defer stmt.Close()
-
-	characterInventory := encodeInventoryAsJson(c.Inv)
-	characterSpells := encodeSpellsAsJson(c.Spells)
-
-	_, err = stmt.Exec(
-		c.Gender,
-		c.Class,
-		c.Sprite,
-		c.Level,
-		c.Exp,
-		c.Access,
-		c.PK,
-		c.Name,
-		c.Guild,
-		c.GuildAccess,
-		c.Vitals.HP,
-		c.Vitals.MP,
-		c.Vitals.SP,
-		c.Stats.Strength,
-		c.Stats.Defense,
-		c.Stats.Speed,
-		c.Stats.Magic,
-		characterInventory,
-		characterSpells,
-		c.Room,
-		c.X,
-		c.Y,
-		c.Dir)
-
-	return err == nil
+	return s.SaveAll(ctx, []*Character{c})
 }
 
-func (c *Character) Delete() bool {
-	if c == nil || c.Id == 0 {
-		return false
+// SaveAll writes the specified characters back to the database in a single transaction.
+// When saving any of the characters fails, none of them are saved.
+func (s *Store) SaveAll(ctx context.Context, characters []*Character) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Printf("error deleting character %d (%s)\n", c.Id, err)
-		return false
+	w := s.newWriter(ctx, tx)
+
+	defer w.close()
+
+	for _, c := range characters {
+		err = w.save(ctx, c)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
 	}
 
-	stmt, err := db.Prepare("DELETE FROM characters WHERE id = ?")
-	if err != nil {
-		log.Printf("error deleting character %d (%s)\n", c.Id, err)
+	return tx.Commit()
+}
+
+func (s *Store) Delete(ctx context.Context, c *Character) bool {
+	if c == nil || c.Id == 0 {
 		return false
 	}
 
-	_, err = stmt.Exec(c.Id)
+	_, err := s.delete.ExecContext(ctx, c.Id)
 	if err != nil {
 		log.Printf("error deleting character %d (%s)\n", c.Id, err)
 		return false
@@ -416,14 +345,12 @@ func (c *Character) Delete() bool {
 	return true
 }
 
-func CreateCharacter(accountId int64, name string, gender Gender, classId int) (*Character, bool) {
-	if Exists(name) {
-		return nil, false
-	}
-
+// NewCharacter returns a new character of the specified class, which has not been created in the database yet.
+// It returns nil if the class does not exist.
+func NewCharacter(accountId int64, name string, gender Gender, classId int) *Character {
 	class := data.GetClass(classId)
 	if class == nil {
-		return nil, false
+		return nil
 	}
 
 	character := &Character{
@@ -458,75 +385,36 @@ func CreateCharacter(accountId int64, name string, gender Gender, classId int) (
 	character.ClearInventory()
 	character.ClearSpells()
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Printf("error creating character '%s' (%s)\n", name, err)
-		return nil, false
-	}
-
-	stmt, err := db.Prepare(
-		`INSERT INTO characters 
-    	(account_id, name, gender, class, sprite, level, exp, access, pk,
-    	 vital_hp, vital_mp, vital_sp, 
-    	 stat_strength, stat_defense, stat_speed, stat_magic,
-    	 inventory, spells, map, x, y, dir) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	return character
+}
 
-	if err != nil {
-		log.Printf("error creating character '%s' (%s)\n", name, err)
-		return nil, false
+// CreateCharacter creates the character in the database, unless a character with the same name already exists.
+func (s *Store) CreateCharacter(ctx context.Context, character *Character) bool {
+	if s.Exists(ctx, character.Name) {
+		return false
 	}
 
-	defer stmt.Close()
-
-	characterInventory := encodeInventoryAsJson(character.Inv)
-	characterSpells := encodeSpellsAsJson(character.Spells)
-
-	result, err := stmt.Exec(
-		character.AccountId,
-		character.Name,
-		character.Gender,
-		character.Class,
-		character.Sprite,
-		character.Level,
-		character.Exp,
-		character.Access,
-		character.PK,
-		character.Vitals.HP,
-		character.Vitals.MP,
-		character.Vitals.SP,
-		character.Stats.Strength,
-		character.Stats.Defense,
-		character.Stats.Speed,
-		character.Stats.Magic,
-		characterInventory,
-		characterSpells,
-		character.Room,
-		character.X,
-		character.Y,
-		character.Dir)
-
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("error creating character '%s' (%s)\n", name, err)
-		return nil, false
+		log.Printf("error creating character '%s' (%s)\n", character.Name, err)
+		return false
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		log.Printf("error creating character '%s' (%s)\n", name, err)
-		return nil, false
-	}
+	w := s.newWriter(ctx, tx)
 
-	character.Id = id
+	defer w.close()
 
-	return character, true
-}
+	character.Id, err = w.create(ctx, character)
+	if err == nil {
+		err = tx.Commit()
+	}
 
-// openDatabase opens the SQLite database and returns a database handle.
-func openDatabase() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "data/characters.db")
 	if err != nil {
-		return nil, err
+		_ = tx.Rollback()
+		character.Id = 0
+		log.Printf("error creating character '%s' (%s)\n", character.Name, err)
+		return false
 	}
-	return db, nil
+
+	return true
 }
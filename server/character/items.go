@@ -0,0 +1,209 @@
+package character
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/guthius/mirage-nova/server/config"
+)
+
+// loadItems loads the inventory and spells of the character.
+func (s *Store) loadItems(ctx context.Context, c *Character) error {
+	c.ClearInventory()
+	c.ClearSpells()
+
+	rows, err := s.loadInventory.QueryContext(ctx, c.Id)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var slot int
+		var item InventorySlot
+
+		err = rows.Scan(&slot, &item.Item, &item.Value, &item.Dur)
+		if err == nil && (slot < 0 || slot >= config.MaxInventory) {
+			err = fmt.Errorf("inventory slot %d is out of range", slot)
+		}
+
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		c.Inv[slot] = item
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	rows, err = s.loadSpells.QueryContext(ctx, c.Id)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var slot int
+		var spell int
+
+		err = rows.Scan(&slot, &spell)
+		if err == nil && (slot < 0 || slot >= config.MaxCharacterSpells) {
+			err = fmt.Errorf("spell slot %d is out of range", slot)
+		}
+
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		c.Spells[slot] = spell
+	}
+
+	return rows.Close()
+}
+
+// writer holds the statements that write characters, bound to a single transaction.
+type writer struct {
+	insertCharacter *sql.Stmt
+	updateCharacter *sql.Stmt
+	deleteInventory *sql.Stmt
+	insertInventory *sql.Stmt
+	deleteSpells    *sql.Stmt
+	insertSpells    *sql.Stmt
+}
+
+func (s *Store) newWriter(ctx context.Context, tx *sql.Tx) *writer {
+	return &writer{
+		insertCharacter: tx.StmtContext(ctx, s.create),
+		updateCharacter: tx.StmtContext(ctx, s.save),
+		deleteInventory: tx.StmtContext(ctx, s.deleteInventory),
+		insertInventory: tx.StmtContext(ctx, s.insertInventory),
+		deleteSpells:    tx.StmtContext(ctx, s.deleteSpells),
+		insertSpells:    tx.StmtContext(ctx, s.insertSpells),
+	}
+}
+
+func (w *writer) close() {
+	_ = w.insertCharacter.Close()
+	_ = w.updateCharacter.Close()
+	_ = w.deleteInventory.Close()
+	_ = w.insertInventory.Close()
+	_ = w.deleteSpells.Close()
+	_ = w.insertSpells.Close()
+}
+
+// create inserts a new character and returns its id.
+func (w *writer) create(ctx context.Context, c *Character) (int64, error) {
+	result, err := w.insertCharacter.ExecContext(ctx,
+		c.AccountId,
+		c.Name,
+		c.Gender,
+		c.Class,
+		c.Sprite,
+		c.Level,
+		c.Exp,
+		c.Access,
+		c.PK,
+		c.Vitals.HP,
+		c.Vitals.MP,
+		c.Vitals.SP,
+		c.Stats.Strength,
+		c.Stats.Defense,
+		c.Stats.Speed,
+		c.Stats.Magic,
+		c.Room,
+		c.X,
+		c.Y,
+		c.Dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, w.saveItems(ctx, id, c)
+}
+
+// save updates the character along with its inventory and spells.
+func (w *writer) save(ctx context.Context, c *Character) error {
+	if c.Id == 0 {
+		return ErrNotCreated
+	}
+
+	_, err := w.updateCharacter.ExecContext(ctx,
+		c.Gender,
+		c.Class,
+		c.Sprite,
+		c.Level,
+		c.Exp,
+		c.Access,
+		c.PK,
+		c.Guild,
+		c.GuildAccess,
+		c.Vitals.HP,
+		c.Vitals.MP,
+		c.Vitals.SP,
+		c.Stats.Strength,
+		c.Stats.Defense,
+		c.Stats.Speed,
+		c.Stats.Magic,
+		c.Equipment.Weapon,
+		c.Equipment.Armor,
+		c.Equipment.Helmet,
+		c.Equipment.Shield,
+		c.Room,
+		c.X,
+		c.Y,
+		c.Dir,
+		c.Id)
+
+	if err != nil {
+		return err
+	}
+
+	return w.saveItems(ctx, c.Id, c)
+}
+
+// saveItems replaces the stored inventory and spells of the character with the occupied slots of the character.
+func (w *writer) saveItems(ctx context.Context, id int64, c *Character) error {
+	_, err := w.deleteInventory.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for slot, item := range c.Inv {
+		if item.Item < 0 {
+			continue
+		}
+
+		_, err = w.insertInventory.ExecContext(ctx, id, slot, item.Item, item.Value, item.Dur)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.deleteSpells.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for slot, spell := range c.Spells {
+		if spell < 0 {
+			continue
+		}
+
+		_, err = w.insertSpells.ExecContext(ctx, id, slot, spell)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
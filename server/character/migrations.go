@@ -0,0 +1,163 @@
+package character
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/guthius/mirage-nova/server/database"
+)
+
+// Migrations are the migrations that bring the schema of the characters database up to date.
+var Migrations = []database.Migration{
+	{
+		Version:     1,
+		Description: "create characters table",
+		Up: database.Exec(`CREATE TABLE IF NOT EXISTS characters (
+		    id INTEGER PRIMARY KEY AUTOINCREMENT,
+		    account_id INTEGER,
+		    name TEXT UNIQUE COLLATE NOCASE,
+		    gender INTEGER NOT NULL DEFAULT 0,
+		    class INTEGER NOT NULL,
+		    sprite INTEGER NOT NULL DEFAULT 0,
+		    level INTEGER NOT NULL DEFAULT 1,
+		    exp INTEGER NOT NULL DEFAULT 0,
+		    access INTEGER NOT NULL DEFAULT 0,
+		    pk INTEGER NOT NULL DEFAULT 0,
+		    guild TEXT NOT NULL COLLATE NOCASE DEFAULT '',
+		    guild_access INTEGER NOT NULL DEFAULT 0,
+		    vital_hp INTEGER NOT NULL,
+		    vital_mp INTEGER NOT NULL,
+		    vital_sp INTEGER NOT NULL,
+		    stat_strength INTEGER NOT NULL,
+		    stat_defense INTEGER NOT NULL,
+		    stat_speed INTEGER NOT NULL,
+		    stat_magic INTEGER NOT NULL,
+		    equip_weapon INTEGER NOT NULL DEFAULT -1,
+		    equip_armor INTEGER NOT NULL DEFAULT -1,
+		    equip_helmet INTEGER NOT NULL DEFAULT -1,
+		    equip_shield INTEGER NOT NULL DEFAULT -1,
+		    inventory TEXT NOT NULL DEFAULT '',
+		    spells TEXT NOT NULL DEFAULT '',
+		    room INTEGER NOT NULL DEFAULT 0, 
+		    x INTEGER NOT NULL DEFAULT 0, 
+		    y INTEGER NOT NULL DEFAULT 0,
+		    dir INTEGER NOT NULL DEFAULT 0
+		)`),
+	},
+	{
+		Version:     2,
+		Description: "move inventory and spells to their own tables",
+		Up: func(ctx context.Context, tx *sql.Tx) error {
+			err := database.Exec(
+				`CREATE TABLE character_inventory (
+				    character_id INTEGER NOT NULL REFERENCES characters (id) ON DELETE CASCADE,
+				    slot INTEGER NOT NULL,
+				    item INTEGER NOT NULL,
+				    value INTEGER NOT NULL DEFAULT 0,
+				    dur INTEGER NOT NULL DEFAULT 0,
+				    PRIMARY KEY (character_id, slot)
+				)`,
+				`CREATE INDEX character_inventory_item ON character_inventory (item)`,
+				`CREATE TABLE character_spells (
+				    character_id INTEGER NOT NULL REFERENCES characters (id) ON DELETE CASCADE,
+				    slot INTEGER NOT NULL,
+				    spell INTEGER NOT NULL,
+				    PRIMARY KEY (character_id, slot)
+				)`,
+				`CREATE INDEX character_spells_spell ON character_spells (spell)`)(ctx, tx)
+
+			if err != nil {
+				return err
+			}
+
+			err = moveItemsFromJson(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			return database.Exec(
+				`ALTER TABLE characters DROP COLUMN inventory`,
+				`ALTER TABLE characters DROP COLUMN spells`)(ctx, tx)
+		},
+	},
+}
+
+// moveItemsFromJson copies the inventory and spells that were stored as JSON in the characters table to their own tables.
+// Characters whose inventory or spells can not be decoded fail the migration, so nothing is lost.
+func moveItemsFromJson(ctx context.Context, tx *sql.Tx) error {
+	type character struct {
+		id        int64
+		inventory string
+		spells    string
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, inventory, spells FROM characters")
+	if err != nil {
+		return err
+	}
+
+	var characters []character
+	for rows.Next() {
+		var c character
+
+		err = rows.Scan(&c.id, &c.inventory, &c.spells)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		characters = append(characters, c)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range characters {
+		var inventory []InventorySlot
+		var spells []int
+
+		if c.inventory != "" {
+			err = json.Unmarshal([]byte(c.inventory), &inventory)
+			if err != nil {
+				return fmt.Errorf("inventory of character %d: %w", c.id, err)
+			}
+		}
+
+		if c.spells != "" {
+			err = json.Unmarshal([]byte(c.spells), &spells)
+			if err != nil {
+				return fmt.Errorf("spells of character %d: %w", c.id, err)
+			}
+		}
+
+		for slot, item := range inventory {
+			if item.Item < 0 {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO character_inventory (character_id, slot, item, value, dur) VALUES (?, ?, ?, ?, ?)",
+				c.id, slot, item.Item, item.Value, item.Dur)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		for slot, spell := range spells {
+			if spell < 0 {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO character_spells (character_id, slot, spell) VALUES (?, ?, ?)", c.id, slot, spell)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
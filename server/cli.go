@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/guthius/mirage-nova/server/data"
+)
+
+type cliCommand struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+// cliCommands are the subcommands that can be given on the command line instead of starting the server.
+var cliCommands = []cliCommand{
+	{
+		name:        "migrate",
+		usage:       "migrate",
+		description: "Applies all pending migrations to the account and character databases.",
+		run:         runMigrate,
+	},
+	{
+		name:        "content",
+		usage:       "content export|import [dir]",
+		description: "Exports game content to JSON files in dir, or imports it from them. The default dir is \"content\".",
+		run:         runContent,
+	},
+	{
+		name:        "validate",
+		usage:       "validate",
+		description: "Checks the game content for broken references, unreachable levels and other problems.",
+		run:         runValidate,
+	},
+}
+
+// RunCommand runs the subcommand specified by the arguments and returns the exit code for the process.
+func RunCommand(args []string) int {
+	for _, cmd := range cliCommands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		err := cmd.run(args[1:])
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+
+		return 0
+	}
+
+	printUsage()
+
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Starts the server when no command is given.")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", cmd.usage, cmd.description)
+	}
+}
+
+func runMigrate(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("migrate does not take any arguments")
+	}
+
+	err := MigrateDatabases()
+	if err != nil {
+		return err
+	}
+
+	log.Println("All databases are up to date")
+
+	return nil
+}
+
+func runValidate(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("validate does not take any arguments")
+	}
+
+	err := data.Load()
+	if err != nil {
+		return err
+	}
+
+	return validateContent()
+}
+
+// validateContent logs all problems found in the game content, and returns an error if any of them are errors.
+// Warnings are only logged.
+func validateContent() error {
+	problems := data.Validate()
+
+	errorCount := 0
+	for _, problem := range problems {
+		log.Println(problem)
+		if problem.Severity == data.SeverityError {
+			errorCount++
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("found %d errors and %d warnings in the game content", errorCount, len(problems)-errorCount)
+	}
+
+	if len(problems) > 0 {
+		log.Printf("Found no errors and %d warnings in the game content\n", len(problems))
+	} else {
+		log.Println("No problems found in the game content")
+	}
+
+	return nil
+}
+
+func runContent(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: content export|import [dir]")
+	}
+
+	dir := "content"
+	if len(args) == 2 {
+		dir = args[1]
+	}
+
+	err := data.Load()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "export":
+		n, err := data.ExportContent(dir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %d records to %s\n", n, dir)
+
+	case "import":
+		result, err := data.ImportContent(dir)
+		if err != nil {
+			if result.Saved > 0 || result.Removed > 0 {
+				log.Printf("Saved %d and removed %d records before the import failed\n", result.Saved, result.Removed)
+			}
+			return err
+		}
+		log.Printf("Imported %d records from %s and removed %d records that it does not contain\n", result.Saved, dir, result.Removed)
+
+	default:
+		return fmt.Errorf("unknown content command '%s'; expected export or import", args[0])
+	}
+
+	return nil
+}
@@ -4,6 +4,44 @@ const (
 	GameName    = "Mirage Nova"
 	GameWebsite = "https://www.miragenova.com"
 	GameAddr    = ":7777"
+	WebAddr     = "" // The address on which WebSocket clients are accepted, like ":7778"; leave empty to disable.
+	MetricsAddr = "" // The address on which metrics are served over HTTP at /debug/vars; leave empty to disable.
+)
+
+// WebOrigins holds the origins of the web pages, other than the WebSocket endpoint itself,
+// that may connect to the server, like "https://play.example.com".
+var WebOrigins = []string{}
+
+const (
+	LoginTimeout     = 60   // The number of seconds a client may remain connected without logging in.
+	IdleTimeout      = 1800 // The number of seconds a logged in client may remain connected without sending any data.
+	HeartbeatTimeout = 30   // The number of seconds a client that supports heartbeats may remain connected without sending any data.
+	HeartbeatRate    = 10   // The number of seconds between the heartbeats sent to clients that support them.
+	KeepAlive        = 15   // The number of seconds between TCP keep-alive probes.
+
+	ReconnectGracePeriod = 60 // The number of seconds a player that lost their connection stays in game; zero disables reconnecting.
+)
+
+const (
+	MaxConnectionsPerIP = 5    // The maximum number of simultaneous connections from a single IP address; zero means no limit.
+	FloodWindow         = 10   // The number of seconds over which packets that exceed their rate limit are counted.
+	FloodKickThreshold  = 50   // The number of packets exceeding their rate limit within the flood window after which a client is kicked.
+	FloodBanWindow      = 600  // The number of seconds over which kicks for flooding are counted.
+	FloodBanThreshold   = 3    // The number of kicks for flooding within the flood ban window after which an IP address is banned.
+	FloodBanDuration    = 1800 // The number of seconds an IP address is banned for flooding.
+)
+
+const (
+	SendQueueSize         = 4096        // The maximum number of packets waiting to be sent to a single client.
+	MaxQueuedBytes        = 1024 * 1024 // The maximum number of bytes waiting to be sent to a single client.
+	DropSlowClientPackets = false       // Whether packets are dropped for clients that fall behind, instead of disconnecting them.
+)
+
+const (
+	TLSEnabled  = false        // Whether clients can connect using TLS.
+	TLSRequired = false        // Whether clients that do not use TLS are rejected.
+	TLSCertFile = "server.crt" // The PEM encoded certificate used for TLS.
+	TLSKeyFile  = "server.key" // The PEM encoded private key of the certificate.
 )
 
 const (
@@ -20,7 +58,50 @@ const (
 	MaxCharacterSpells = 20
 	MaxTrades          = 8
 
-	NameLength = 32
+	NameLength      = 32
+	MaxStringLength = 512       // The maximum length of strings in packets received from clients.
+	MaxPacketSize   = 64 * 1024 // The maximum size of a compressed packet received from a client after decompression.
+)
+
+const (
+	ContentBackend  = "gob"             // The backend in which game content is stored: "gob", "json" or "sqlite".
+	ContentDatabase = "data/content.db" // The database in which game content is stored when the "sqlite" backend is used.
+	ContentBackups  = 2                 // The number of previous versions kept of each content file; zero disables backups.
+
+	ValidateContent      = true // Whether the game content is checked for problems on startup; the server does not start when errors are found.
+	ContentWatchInterval = 0    // The number of seconds between checks for changed content, which is reloaded when found; zero disables watching.
+)
+
+const (
+	CompressionThreshold = 256 // Packets larger than this number of bytes are compressed for clients that support it.
+	ContentBatchSize     = 50  // The maximum number of records sent in a single packet when content is sent in bulk.
+)
+
+const (
+	TickRate          = 20   // The number of times per second the game loop processes queued commands and timers.
+	MaxQueuedCommands = 4096 // The maximum number of commands that can be waiting for the game loop.
+	DoorOpenTime      = 5000 // The number of milliseconds a door remains open after being unlocked.
+)
+
+const (
+	WalkDelay              = 240 // The minimum number of milliseconds between two steps of a walking player.
+	RunDelay               = 120 // The minimum number of milliseconds between two steps of a running player.
+	MoveTolerance          = 500 // The number of milliseconds a player may get ahead of their speed, to allow for network jitter.
+	MoveViolationWindow    = 10  // The number of seconds over which rejected moves are counted.
+	MoveViolationThreshold = 20  // The number of rejected moves within the violation window after which a player is kicked.
+)
+
+const (
+	DatabaseBusyTimeout  = 5000 // The number of milliseconds to wait for a database that is locked by another connection.
+	DatabaseQueryTimeout = 5    // The number of seconds after which a database query is cancelled.
+	AutoMigrate          = true // Whether database migrations are applied on startup, instead of requiring the migrate command.
+
+	AutosaveInterval = 300 // The number of seconds between automatic saves of all characters in game; zero disables autosaving.
+)
+
+const (
+	ShutdownCountdown = 30 // The number of seconds between starting a shutdown and the server actually shutting down.
+	ShutdownDrainTime = 10 // The maximum number of seconds to wait for pending data to be sent to clients on shutdown.
 )
 
 const (
@@ -29,6 +110,11 @@ const (
 	VersionRevision = 0
 )
 
+const (
+	ProtocolVersion    = 2 // The newest version of the protocol supported by the server.
+	MinProtocolVersion = 1 // The oldest version of the protocol supported by the server.
+)
+
 const (
 	StartRoom = 5
 	StartX    = 5
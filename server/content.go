@@ -0,0 +1,126 @@
+package main
+
+import (
+	"hash/fnv"
+
+	"github.com/guthius/mirage-nova/net"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
+)
+
+// Clients that support the content manifest receive a hash of each category of content when they join the game,
+// instead of one packet for every record. They compare the hashes with the content they have stored locally and
+// request the categories that differ, which are then sent in bulk.
+//
+// The hash of a category is the 32-bit FNV-1a hash of the SvUpdate* packets of all records in the category,
+// encoded in order of their id. Records without a name are not sent and are not part of the hash.
+
+// getItemRecords returns the update packets of all items.
+func getItemRecords() []SvUpdateItemPacket {
+	records := make([]SvUpdateItemPacket, 0, config.MaxItems)
+	for i := 0; i < config.MaxItems; i++ {
+		item := data.GetItem(i)
+		if item == nil || len(item.Name) == 0 {
+			continue
+		}
+		records = append(records, *getUpdateItemPacket(i, item))
+	}
+	return records
+}
+
+// getNpcRecords returns the update packets of all NPC's.
+func getNpcRecords() []SvUpdateNpcPacket {
+	records := make([]SvUpdateNpcPacket, 0, config.MaxNpcs)
+	for i := 0; i < config.MaxNpcs; i++ {
+		npcData := data.GetNpc(i)
+		if npcData == nil || len(npcData.Name) == 0 {
+			continue
+		}
+		records = append(records, *getUpdateNpcPacket(i, npcData))
+	}
+	return records
+}
+
+// getShopRecords returns the update packets of all shops.
+func getShopRecords() []SvUpdateShopPacket {
+	records := make([]SvUpdateShopPacket, 0, config.MaxShops)
+	for i := 0; i < config.MaxShops; i++ {
+		shop := data.GetShop(i)
+		if shop == nil || len(shop.Name) == 0 {
+			continue
+		}
+		records = append(records, *getUpdateShopPacket(i, shop))
+	}
+	return records
+}
+
+// getSpellRecords returns the update packets of all spells.
+func getSpellRecords() []SvUpdateSpellPacket {
+	records := make([]SvUpdateSpellPacket, 0, config.MaxSpells)
+	for i := 0; i < config.MaxSpells; i++ {
+		spell := data.GetSpell(i)
+		if spell == nil || len(spell.Name) == 0 {
+			continue
+		}
+		records = append(records, *getUpdateSpellPacket(i, spell))
+	}
+	return records
+}
+
+// hashRecords returns the hash of the specified records, each encoded as a packet for the specified protocol version.
+func hashRecords[T any, P interface {
+	*T
+	net.Packet
+}](records []T, version int) uint32 {
+	h := fnv.New32a()
+	for i := range records {
+		_, _ = h.Write(net.EncodePacketVersion(P(&records[i]), version))
+	}
+	return h.Sum32()
+}
+
+// sendBatches sends the records to the player using packets of at most config.ContentBatchSize records each.
+func sendBatches[T any](player *PlayerData, records []T, newPacket func(batch []T) net.Packet) {
+	for len(records) > 0 {
+		n := min(len(records), config.ContentBatchSize)
+		player.SendPacket(newPacket(records[:n]))
+		records = records[n:]
+	}
+}
+
+// SendContentManifest sends the hash of each category of content to the player.
+func SendContentManifest(player *PlayerData) {
+	player.SendPacket(&SvContentManifestPacket{
+		Items:  hashRecords(getItemRecords(), player.Protocol),
+		Npcs:   hashRecords(getNpcRecords(), player.Protocol),
+		Shops:  hashRecords(getShopRecords(), player.Protocol),
+		Spells: hashRecords(getSpellRecords(), player.Protocol),
+	})
+}
+
+// SendContent sends all records of the requested categories of content to the player in bulk.
+func SendContent(player *PlayerData, request *ClRequestContentPacket) {
+	if request.Items {
+		sendBatches(player, getItemRecords(), func(batch []SvUpdateItemPacket) net.Packet {
+			return &SvItemsPacket{Items: batch}
+		})
+	}
+
+	if request.Npcs {
+		sendBatches(player, getNpcRecords(), func(batch []SvUpdateNpcPacket) net.Packet {
+			return &SvNpcsPacket{Npcs: batch}
+		})
+	}
+
+	if request.Shops {
+		sendBatches(player, getShopRecords(), func(batch []SvUpdateShopPacket) net.Packet {
+			return &SvShopsPacket{Shops: batch}
+		})
+	}
+
+	if request.Spells {
+		sendBatches(player, getSpellRecords(), func(batch []SvUpdateSpellPacket) net.Packet {
+			return &SvSpellsPacket{Spells: batch}
+		})
+	}
+}
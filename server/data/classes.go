@@ -3,7 +3,6 @@
 import (
 	"encoding/json"
 	"io"
-	"log"
 	"os"
 
 	"github.com/guthius/mirage-nova/server/data/stats"
@@ -18,25 +17,28 @@ type ClassData struct {
 
 var classes []ClassData
 
-func init() {
+// loadClasses reads the classes from data/classes.json.
+func loadClasses() ([]ClassData, error) {
 	file, err := os.OpenFile("data/classes.json", os.O_RDONLY, 0644)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	defer file.Close()
 
 	bytes, err := io.ReadAll(file)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = json.Unmarshal(bytes, &classes)
+	var result []ClassData
+
+	err = json.Unmarshal(bytes, &result)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	log.Printf("Loaded %d classes\n", len(classes))
+	return result, nil
 }
 
 // GetClassCount returns the number of classes available.
@@ -0,0 +1,66 @@
+package data
+
+// ContentType identifies a type of game content.
+type ContentType int
+
+const (
+	ContentItems ContentType = iota
+	ContentNpcs
+	ContentShops
+	ContentSpells
+	ContentLevels
+
+	contentTypeCount
+)
+
+var dirty [contentTypeCount]map[int]struct{}
+
+// saveCount counts the records saved so far, and savedAt holds the count at which each record was last saved.
+var saveCount uint64
+var savedAt [contentTypeCount]map[int]uint64
+
+var saveFuncs = [contentTypeCount]func(id int){
+	ContentItems:  SaveItem,
+	ContentNpcs:   SaveNpc,
+	ContentShops:  SaveShop,
+	ContentSpells: SaveSpell,
+	ContentLevels: SaveLevel,
+}
+
+// MarkDirty marks the record of the specified content type and ID as modified, so that it is saved by SaveDirty.
+func MarkDirty(contentType ContentType, id int) {
+	if dirty[contentType] == nil {
+		dirty[contentType] = make(map[int]struct{})
+	}
+	dirty[contentType][id] = struct{}{}
+}
+
+// isModifiedSince returns true if the record of the specified content type and ID has unsaved modifications,
+// or has been saved after the save count was at the specified value.
+func isModifiedSince(contentType ContentType, id int, count uint64) bool {
+	if _, ok := dirty[contentType][id]; ok {
+		return true
+	}
+	return savedAt[contentType][id] > count
+}
+
+// clearDirty marks the record of the specified content type and ID as saved.
+func clearDirty(contentType ContentType, id int) {
+	delete(dirty[contentType], id)
+
+	if savedAt[contentType] == nil {
+		savedAt[contentType] = make(map[int]uint64)
+	}
+
+	saveCount++
+	savedAt[contentType][id] = saveCount
+}
+
+// SaveDirty saves all records that have been modified since they were last saved.
+func SaveDirty() {
+	for contentType, ids := range dirty {
+		for id := range ids {
+			saveFuncs[contentType](id)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/storage"
+)
+
+// contentTransfer exports and imports the records of a single content type.
+type contentTransfer struct {
+	name    string
+	export  func(dir string) (int, error)
+	prepare func(dir string) (commit func(result *ImportResult) error, err error)
+}
+
+// ImportResult holds the number of records that were changed by an import.
+type ImportResult struct {
+	Saved   int // The number of records that were saved.
+	Removed int // The number of stored records that were removed, as the import did not contain them.
+}
+
+// getContentTransfers returns the transfers of all content types. The stores must have been opened by Load.
+func getContentTransfers() []contentTransfer {
+	return []contentTransfer{
+		newContentTransfer("items", itemStore, config.MaxItems, resetItemData),
+		newContentTransfer("npcs", npcStore, config.MaxNpcs, resetNpcData),
+		newContentTransfer("shops", shopStore, config.MaxShops, resetShopData),
+		newContentTransfer("spells", spellStore, config.MaxSpells, resetSpellData),
+		newContentTransfer("levels", levelStore, config.MaxMaps, resetLevelData),
+	}
+}
+
+func newContentTransfer[K any](name string, store storage.Store[K], count int, reset func(*K)) contentTransfer {
+	return contentTransfer{
+		name: name,
+		export: func(dir string) (int, error) {
+			return exportRecords(store, dir)
+		},
+		prepare: func(dir string) (func(result *ImportResult) error, error) {
+			records, found, err := readRecords(dir, count, reset)
+			if err != nil {
+				return nil, err
+			}
+
+			var removed []int
+
+			// Records that were deleted since the content was exported are removed, so the store matches the import.
+			// When the import has no directory for the content type at all, the stored records are left alone.
+			if found {
+				stored, err := store.List()
+				if err != nil {
+					return nil, err
+				}
+
+				removed = slices.DeleteFunc(stored, func(id int) bool {
+					_, ok := records[id]
+					return ok
+				})
+			}
+
+			commit := func(result *ImportResult) error {
+				for _, id := range slices.Sorted(maps.Keys(records)) {
+					err := store.Save(id, records[id])
+					if err != nil {
+						return fmt.Errorf("%d: %w", id, err)
+					}
+					result.Saved++
+				}
+
+				for _, id := range removed {
+					err := store.Delete(id)
+					if err != nil {
+						return fmt.Errorf("%d: %w", id, err)
+					}
+					result.Removed++
+				}
+
+				return nil
+			}
+
+			return commit, nil
+		},
+	}
+}
+
+// ExportContent writes every stored record of all content types to the specified directory as pretty-printed JSON.
+// Each record is written to its own file, <dir>/<type>/<id>.json, so changes to content can be reviewed like code.
+// JSON files of records that are no longer stored are removed, so importing the directory does not bring them back.
+// It returns the number of records that were exported.
+func ExportContent(dir string) (int, error) {
+	total := 0
+
+	for _, t := range getContentTransfers() {
+		n, err := t.export(path.Join(dir, t.name))
+		if err != nil {
+			return total, fmt.Errorf("exporting %s: %w", t.name, err)
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+// ImportContent reads the records that were exported with ExportContent from the specified directory
+// and saves them to the content store. Stored records that have no file in the directory of their content type
+// are removed; content types without a directory are left unchanged. The directory itself must exist.
+// All files are read and checked before any record is saved. When saving fails, the records that were
+// changed before the failure stay changed; the returned result holds the changes that were made either way.
+func ImportContent(dir string) (ImportResult, error) {
+	var result ImportResult
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return result, err
+	}
+	if !info.IsDir() {
+		return result, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	transfers := getContentTransfers()
+	commits := make([]func(result *ImportResult) error, 0, len(transfers))
+
+	for _, t := range transfers {
+		commit, err := t.prepare(path.Join(dir, t.name))
+		if err != nil {
+			return result, fmt.Errorf("importing %s: %w", t.name, err)
+		}
+
+		commits = append(commits, commit)
+	}
+
+	for i, commit := range commits {
+		err := commit(&result)
+		if err != nil {
+			return result, fmt.Errorf("saving %s: %w", transfers[i].name, err)
+		}
+	}
+
+	return result, nil
+}
+
+func exportRecords[K any](store storage.Store[K], dir string) (int, error) {
+	ids, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	files := make(map[string]bool, len(ids))
+
+	for _, id := range ids {
+		record, err := store.Load(id)
+		if err != nil {
+			return 0, fmt.Errorf("%d: %w", id, err)
+		}
+
+		bytes, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("%d: %w", id, err)
+		}
+
+		name := fmt.Sprintf("%03d.json", id)
+
+		err = os.WriteFile(path.Join(dir, name), append(bytes, '\n'), 0644)
+		if err != nil {
+			return 0, err
+		}
+
+		files[name] = true
+	}
+
+	err = removeStaleFiles(dir, files)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// removeStaleFiles removes the JSON files from the specified directory that were not just exported.
+func removeStaleFiles(dir string, exported map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || exported[entry.Name()] || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		err = os.Remove(path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRecords reads all records from the JSON files in the specified directory.
+// Fields that do not exist in the record are rejected, so typos do not go unnoticed.
+// The returned bool is false when the directory does not exist, in which case there are no records.
+func readRecords[K any](dir string, count int, reset func(*K)) (map[int]*K, bool, error) {
+	records := make(map[int]*K)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, false, nil
+		}
+		return nil, false, err
+	}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		id, err := strconv.Atoi(name)
+		if err != nil || id < 0 || id >= count {
+			return nil, false, fmt.Errorf("%s: the name of the file must be an ID between 0 and %d", entry.Name(), count-1)
+		}
+
+		if _, exists := records[id]; exists {
+			return nil, false, fmt.Errorf("%s: there is more than one file for ID %d", entry.Name(), id)
+		}
+
+		data, err := os.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, false, err
+		}
+
+		record := new(K)
+		reset(record)
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+
+		err = decoder.Decode(record)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		records[id] = record
+	}
+
+	return records, true, nil
+}
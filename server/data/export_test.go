@@ -0,0 +1,280 @@
+package data
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/guthius/mirage-nova/storage"
+)
+
+// useTestStores replaces the content stores with empty stores in a temporary directory for the duration of the test.
+func useTestStores(t *testing.T) {
+	dir := t.TempDir()
+
+	oldItems, oldNpcs, oldShops, oldSpells, oldLevels := itemStore, npcStore, shopStore, spellStore, levelStore
+	t.Cleanup(func() {
+		itemStore, npcStore, shopStore, spellStore, levelStore = oldItems, oldNpcs, oldShops, oldSpells, oldLevels
+	})
+
+	itemStore = storage.NewJSONFileStore(path.Join(dir, "items"), "item", resetItemData)
+	npcStore = storage.NewJSONFileStore(path.Join(dir, "npcs"), "npc", resetNpcData)
+	shopStore = storage.NewJSONFileStore(path.Join(dir, "shops"), "shop", resetShopData)
+	spellStore = storage.NewJSONFileStore(path.Join(dir, "spells"), "spell", resetSpellData)
+	levelStore = storage.NewJSONFileStore(path.Join(dir, "levels"), "level", resetLevelData)
+}
+
+func saveItem(t *testing.T, id int, name string) {
+	t.Helper()
+
+	item := new(ItemData)
+	resetItemData(item)
+	item.Name = name
+
+	if err := itemStore.Save(id, item); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func storedItems(t *testing.T) map[int]string {
+	t.Helper()
+
+	ids, err := itemStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[int]string)
+	for _, id := range ids {
+		item, err := itemStore.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[id] = item.Name
+	}
+	return names
+}
+
+func TestImportContentReplacesStoredContent(t *testing.T) {
+	useTestStores(t)
+	exportDir := t.TempDir()
+
+	saveItem(t, 0, "Sword")
+	saveItem(t, 3, "Shield")
+
+	n, err := ExportContent(exportDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("exported %d records, want 2", n)
+	}
+
+	saveItem(t, 3, "Changed")
+	saveItem(t, 5, "Added after the export")
+
+	result, err := ImportContent(exportDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Saved: 2, Removed: 1}) {
+		t.Errorf("import result is %+v, want 2 saved and 1 removed", result)
+	}
+
+	want := map[int]string{0: "Sword", 3: "Shield"}
+	if got := storedItems(t); !maps.Equal(got, want) {
+		t.Errorf("stored items are %v, want %v", got, want)
+	}
+}
+
+func TestImportContentChecksAllFilesFirst(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		error string
+	}{
+		{"unknown field", "levels/001.json", `{"Nmae": "Typo"}`, "importing levels: 001.json"},
+		{"invalid id", "npcs/abc.json", `{}`, "importing npcs: abc.json"},
+		{"id out of range", "spells/9999.json", `{}`, "importing spells: 9999.json"},
+		{"invalid json", "shops/000.json", `{`, "importing shops: 000.json"},
+	}
+
+	for _, tt := range tests {
+		useTestStores(t)
+		exportDir := t.TempDir()
+
+		saveItem(t, 1, "Potion")
+		if _, err := ExportContent(exportDir); err != nil {
+			t.Fatal(err)
+		}
+		saveItem(t, 1, "Unchanged")
+
+		file := path.Join(exportDir, tt.file)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := ImportContent(exportDir)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.error) {
+			t.Errorf("%s: import returned error %v, want one starting with %q", tt.name, err, tt.error)
+		}
+		if result != (ImportResult{}) {
+			t.Errorf("%s: import changed %+v records", tt.name, result)
+		}
+		if got := storedItems(t); got[1] != "Unchanged" {
+			t.Errorf("%s: item 1 is %q after a failed import, want it unchanged", tt.name, got[1])
+		}
+	}
+}
+
+// failingStore is a store that fails to save the record with a specific ID.
+type failingStore[K any] struct {
+	storage.Store[K]
+	failId int
+}
+
+var errSaveFailed = errors.New("save failed")
+
+func (s failingStore[K]) Save(id int, data *K) error {
+	if id == s.failId {
+		return errSaveFailed
+	}
+	return s.Store.Save(id, data)
+}
+
+func TestImportContentReportsPartialImport(t *testing.T) {
+	useTestStores(t)
+	exportDir := t.TempDir()
+
+	saveItem(t, 0, "Sword")
+	saveItem(t, 1, "Shield")
+
+	npc := new(NpcData)
+	resetNpcData(npc)
+	for _, id := range []int{0, 1, 2} {
+		if err := npcStore.Save(id, npc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ExportContent(exportDir); err != nil {
+		t.Fatal(err)
+	}
+
+	npcStore = failingStore[NpcData]{Store: npcStore, failId: 2}
+
+	result, err := ImportContent(exportDir)
+	if !errors.Is(err, errSaveFailed) {
+		t.Fatalf("import returned error %v, want %v", err, errSaveFailed)
+	}
+	if want := "saving npcs: 2: save failed"; err.Error() != want {
+		t.Errorf("import returned error %q, want %q", err, want)
+	}
+
+	// The items and the first two NPC's were saved before the failure
+	if result != (ImportResult{Saved: 4}) {
+		t.Errorf("import result is %+v, want 4 saved", result)
+	}
+}
+
+func TestImportContentFromMissingDirectory(t *testing.T) {
+	useTestStores(t)
+
+	saveItem(t, 0, "Sword")
+	saveItem(t, 1, "Shield")
+
+	result, err := ImportContent(path.Join(t.TempDir(), "does-not-exist"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("import returned error %v, want a not exist error", err)
+	}
+	if result != (ImportResult{}) {
+		t.Errorf("import changed %+v records", result)
+	}
+
+	want := map[int]string{0: "Sword", 1: "Shield"}
+	if got := storedItems(t); !maps.Equal(got, want) {
+		t.Errorf("stored items are %v after a failed import, want %v", got, want)
+	}
+}
+
+func TestImportContentKeepsTypesWithoutDirectory(t *testing.T) {
+	useTestStores(t)
+	importDir := t.TempDir()
+
+	saveItem(t, 0, "Sword")
+
+	npc := new(NpcData)
+	resetNpcData(npc)
+	if err := npcStore.Save(0, npc); err != nil {
+		t.Fatal(err)
+	}
+
+	// The import only has an empty NPC directory, so all NPC's are removed and the items are kept
+	if err := os.Mkdir(path.Join(importDir, "npcs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ImportContent(importDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Removed: 1}) {
+		t.Errorf("import result is %+v, want 1 removed", result)
+	}
+
+	if got := storedItems(t); got[0] != "Sword" {
+		t.Errorf("stored items are %v, want the item without an import directory kept", got)
+	}
+}
+
+func TestExportContentRemovesStaleFiles(t *testing.T) {
+	useTestStores(t)
+	exportDir := t.TempDir()
+
+	saveItem(t, 0, "Sword")
+	saveItem(t, 1, "Shield")
+
+	if _, err := ExportContent(exportDir); err != nil {
+		t.Fatal(err)
+	}
+
+	notes := path.Join(exportDir, "items", "README.txt")
+	if err := os.WriteFile(notes, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := itemStore.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ExportContent(exportDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path.Join(exportDir, "items", "001.json")); !os.IsNotExist(err) {
+		t.Errorf("the file of the deleted item was kept by the export")
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("a file that is not a record was removed by the export: %v", err)
+	}
+
+	result, err := ImportContent(exportDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Saved: 1}) {
+		t.Errorf("import result is %+v, want 1 saved", result)
+	}
+
+	want := map[int]string{0: "Sword"}
+	if got := storedItems(t); !maps.Equal(got, want) {
+		t.Errorf("stored items are %v, want %v", got, want)
+	}
+}
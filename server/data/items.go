@@ -35,16 +35,15 @@ type ItemData struct {
 	Data3 int
 }
 
-var itemStore = storage.NewFileStore("data/items", "items", resetItemData)
+var itemStore storage.Store[ItemData]
 var items [config.MaxItems]*ItemData
 
-func init() {
+// loadItems opens the item store and loads all items from it.
+func loadItems() {
+	itemStore = newStore("items", "items", resetItemData)
+
 	for i := 0; i < config.MaxItems; i++ {
-		item, err := itemStore.Load(i)
-		if err != nil {
-			log.Printf("error loading item %03d (%s)\n", i, err)
-		}
-		items[i] = item
+		items[i] = loadRecord(itemStore, "item", i, resetItemData)
 	}
 }
 
@@ -58,7 +57,7 @@ func resetItemData(item *ItemData) {
 	item.Data3 = 0
 }
 
-// SaveItem saves the data of the item with the specified ID to the backing file store.
+// SaveItem saves the data of the item with the specified ID to the content store.
 func SaveItem(id int) {
 	if id < 0 || id >= config.MaxItems {
 		return
@@ -67,10 +66,13 @@ func SaveItem(id int) {
 	err := itemStore.Save(id, items[id])
 	if err != nil {
 		log.Printf("error saving item %03d (%s)\n", id, err)
+		return
 	}
+
+	clearDirty(ContentItems, id)
 }
 
-// SaveAllItems saves the data of all items to the backing file store.
+// SaveAllItems saves the data of all items to the content store.
 func SaveAllItems() {
 	for i := 0; i < config.MaxItems; i++ {
 		SaveItem(i)
@@ -12,6 +12,11 @@ const (
 	maxHeight = 12
 )
 
+const (
+	MaxTiles      = maxWidth * maxHeight // The number of tiles in a level.
+	MaxTileLayers = 9                    // The number of graphic layers of a tile.
+)
+
 type TileType int
 
 const (
@@ -33,7 +38,7 @@ const (
 )
 
 type Tile struct {
-	Num   [9]int
+	Num   [MaxTileLayers]int
 	Type  TileType
 	Data1 int
 	Data2 int
@@ -65,20 +70,19 @@ type LevelData struct {
 	Shop     int
 	Width    int
 	Height   int
-	Tiles    [maxWidth * maxHeight]Tile
+	Tiles    [MaxTiles]Tile
 	Npcs     [config.MaxMapNpcs]int
 }
 
-var levelStore = storage.NewFileStore("data/levels", "level", resetLevelData)
+var levelStore storage.Store[LevelData]
 var levels [config.MaxMaps]*LevelData
 
-func init() {
+// loadLevels opens the level store and loads all levels from it.
+func loadLevels() {
+	levelStore = newStore("levels", "level", resetLevelData)
+
 	for i := 0; i < config.MaxMaps; i++ {
-		level, err := levelStore.Load(i)
-		if err != nil {
-			log.Printf("error loading level %03d (%s)\n", i, err)
-		}
-		levels[i] = level
+		levels[i] = loadRecord(levelStore, "level", i, resetLevelData)
 	}
 }
 
@@ -124,7 +128,7 @@ func (level *LevelData) resetNpcs() {
 	}
 }
 
-// SaveLevel saves the data of the level with the specified ID to the backing file store.
+// SaveLevel saves the data of the level with the specified ID to the content store.
 func SaveLevel(id int) {
 	if id < 0 || id >= config.MaxMaps {
 		return
@@ -133,10 +137,13 @@ func SaveLevel(id int) {
 	err := levelStore.Save(id, levels[id])
 	if err != nil {
 		log.Printf("error saving level %03d (%s)\n", id, err)
+		return
 	}
+
+	clearDirty(ContentLevels, id)
 }
 
-// SaveAllLevels saves the data of all levels to the backing file store.
+// SaveAllLevels saves the data of all levels to the content store.
 func SaveAllLevels() {
 	for i := 0; i < config.MaxMaps; i++ {
 		SaveLevel(i)
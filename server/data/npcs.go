@@ -31,16 +31,15 @@ type NpcData struct {
 	Stats         stats.Data
 }
 
-var npcStore = storage.NewFileStore("data/npcs", "npc", resetNpcData)
+var npcStore storage.Store[NpcData]
 var npcs [config.MaxNpcs]*NpcData
 
-func init() {
+// loadNpcs opens the npc store and loads all npcs from it.
+func loadNpcs() {
+	npcStore = newStore("npcs", "npc", resetNpcData)
+
 	for i := 0; i < config.MaxNpcs; i++ {
-		npc, err := npcStore.Load(i)
-		if err != nil {
-			log.Printf("error loading npc %03d (%s)\n", i, err)
-		}
-		npcs[i] = npc
+		npcs[i] = loadRecord(npcStore, "npc", i, resetNpcData)
 	}
 }
 
@@ -58,7 +57,7 @@ func resetNpcData(n *NpcData) {
 	n.Stats.Reset()
 }
 
-// SaveNpc saves the data of the NPC with the specified ID to the backing file store.
+// SaveNpc saves the data of the NPC with the specified ID to the content store.
 func SaveNpc(id int) {
 	if id < 0 || id >= config.MaxNpcs {
 		return
@@ -67,10 +66,13 @@ func SaveNpc(id int) {
 	err := npcStore.Save(id, npcs[id])
 	if err != nil {
 		log.Printf("error saving npc %03d (%s)\n", id, err)
+		return
 	}
+
+	clearDirty(ContentNpcs, id)
 }
 
-// SaveAllNpcs saves the data of all NPC's to the backing file store.
+// SaveAllNpcs saves the data of all NPC's to the content store.
 func SaveAllNpcs() {
 	for i := 0; i < config.MaxNpcs; i++ {
 		SaveNpc(i)
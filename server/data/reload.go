@@ -0,0 +1,130 @@
+package data
+
+import (
+	"log"
+	"reflect"
+	"slices"
+
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/storage"
+)
+
+// Snapshot holds the game content as it is stored, so it can be compared with the content in use.
+type Snapshot struct {
+	saveCount uint64
+	items     []*ItemData
+	npcs      []*NpcData
+	shops     []*ShopData
+	spells    []*SpellData
+	levels    []*LevelData
+	classes   []ClassData
+}
+
+// Changes lists the records that were replaced when a snapshot was applied.
+type Changes struct {
+	Items   []int
+	Npcs    []int
+	Shops   []int
+	Spells  []int
+	Levels  []int
+	Classes bool
+}
+
+// Count returns the total number of records that were replaced.
+func (c *Changes) Count() int {
+	count := len(c.Items) + len(c.Npcs) + len(c.Shops) + len(c.Spells) + len(c.Levels)
+	if c.Classes {
+		count++
+	}
+	return count
+}
+
+// NewSnapshot returns an empty snapshot. It must be called from the goroutine that uses the content,
+// so that records saved while the snapshot is being loaded can be recognized when it is applied.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{saveCount: saveCount}
+}
+
+// Load loads all game content from the content store into the snapshot. It only reads from the content store,
+// so it is safe to call from any goroutine. Records that can not be loaded are logged and left out of the snapshot.
+func (s *Snapshot) Load() {
+	s.items = loadSnapshotRecords(itemStore, "item", config.MaxItems)
+	s.npcs = loadSnapshotRecords(npcStore, "npc", config.MaxNpcs)
+	s.shops = loadSnapshotRecords(shopStore, "shop", config.MaxShops)
+	s.spells = loadSnapshotRecords(spellStore, "spell", config.MaxSpells)
+	s.levels = loadSnapshotRecords(levelStore, "level", config.MaxMaps)
+
+	var err error
+
+	s.classes, err = loadClasses()
+	if err != nil {
+		log.Printf("error loading classes (%s)\n", err)
+	}
+}
+
+func loadSnapshotRecords[K any](store storage.Store[K], name string, count int) []*K {
+	records := make([]*K, count)
+	for i := 0; i < count; i++ {
+		record, err := store.Load(i)
+		if err != nil {
+			log.Printf("error loading %s %03d (%s)\n", name, i, err)
+			continue
+		}
+		records[i] = record
+	}
+	return records
+}
+
+// Apply replaces the records in use that differ from the snapshot, and returns the records it replaced.
+// Records are replaced in place, so references to them remain valid. Records that were modified after the
+// snapshot was created are kept, so changes made in game are not lost. It must be called from the goroutine
+// that uses the content.
+func (s *Snapshot) Apply() Changes {
+	var changes Changes
+
+	// Clients keep the levels they have downloaded until the revision changes, so a reloaded level
+	// gets a newer revision than the one in use. It is saved with that revision, so it is not reloaded again.
+	var revised []int
+	for i, level := range s.levels {
+		if level == nil || isModifiedSince(ContentLevels, i, s.saveCount) || reflect.DeepEqual(level, levels[i]) {
+			continue
+		}
+		if level.Revision <= levels[i].Revision {
+			level.Revision = levels[i].Revision + 1
+			revised = append(revised, i)
+		}
+	}
+
+	changes.Items = applyRecords(items[:], s.items, ContentItems, s.saveCount)
+	changes.Npcs = applyRecords(npcs[:], s.npcs, ContentNpcs, s.saveCount)
+	changes.Shops = applyRecords(shops[:], s.shops, ContentShops, s.saveCount)
+	changes.Spells = applyRecords(spells[:], s.spells, ContentSpells, s.saveCount)
+	changes.Levels = applyRecords(levels[:], s.levels, ContentLevels, s.saveCount)
+
+	for _, id := range revised {
+		SaveLevel(id)
+	}
+
+	if s.classes != nil && !slices.Equal(s.classes, classes) {
+		classes = s.classes
+		changes.Classes = true
+	}
+
+	return changes
+}
+
+func applyRecords[K any](current []*K, loaded []*K, contentType ContentType, saveCount uint64) []int {
+	var changed []int
+
+	for i, record := range loaded {
+		if record == nil || isModifiedSince(contentType, i, saveCount) || reflect.DeepEqual(record, current[i]) {
+			continue
+		}
+
+		*current[i] = *record
+
+		changed = append(changed, i)
+	}
+
+	return changed
+}
@@ -22,16 +22,15 @@ type ShopData struct {
 	TradeItems [config.MaxTrades]TradeItemData
 }
 
-var shopStore = storage.NewFileStore("data/shops", "shop", resetShopData)
+var shopStore storage.Store[ShopData]
 var shops [config.MaxShops]*ShopData
 
-func init() {
+// loadShops opens the shop store and loads all shops from it.
+func loadShops() {
+	shopStore = newStore("shops", "shop", resetShopData)
+
 	for i := 0; i < config.MaxShops; i++ {
-		shop, err := shopStore.Load(i)
-		if err != nil {
-			log.Printf("Error loading shop %03d (%s)\n", i, err)
-		}
-		shops[i] = shop
+		shops[i] = loadRecord(shopStore, "shop", i, resetShopData)
 	}
 }
 
@@ -54,7 +53,7 @@ func (item *TradeItemData) reset() {
 	item.GetValue = 0
 }
 
-// SaveShop saves the data of the shop with the specified ID to the backing file store.
+// SaveShop saves the data of the shop with the specified ID to the content store.
 func SaveShop(id int) {
 	if id < 0 || id >= config.MaxShops {
 		return
@@ -63,10 +62,13 @@ func SaveShop(id int) {
 	err := shopStore.Save(id, shops[id])
 	if err != nil {
 		log.Printf("error saving shop %03d (%s)\n", id, err)
+		return
 	}
+
+	clearDirty(ContentShops, id)
 }
 
-// SaveAllShops saves the data of all shops to the backing file store.
+// SaveAllShops saves the data of all shops to the content store.
 func SaveAllShops() {
 	for i := 0; i < config.MaxShops; i++ {
 		SaveShop(i)
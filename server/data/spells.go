@@ -31,16 +31,15 @@ type SpellData struct {
 	Data3    int
 }
 
-var spellStore = storage.NewFileStore("data/spells", "spell", resetSpellData)
+var spellStore storage.Store[SpellData]
 var spells [config.MaxSpells]*SpellData
 
-func init() {
+// loadSpells opens the spell store and loads all spells from it.
+func loadSpells() {
+	spellStore = newStore("spells", "spell", resetSpellData)
+
 	for i := 0; i < config.MaxSpells; i++ {
-		spell, err := spellStore.Load(i)
-		if err != nil {
-			log.Printf("error loading spell %03d (%s)\n", i, err)
-		}
-		spells[i] = spell
+		spells[i] = loadRecord(spellStore, "spell", i, resetSpellData)
 	}
 }
 
@@ -57,7 +56,7 @@ func resetSpellData(s *SpellData) {
 	s.Data3 = 0
 }
 
-// SaveSpell saves the data of the spell with the specified ID to the backing file store.
+// SaveSpell saves the data of the spell with the specified ID to the content store.
 func SaveSpell(id int) {
 	if id < 0 || id >= config.MaxSpells {
 		return
@@ -66,10 +65,13 @@ func SaveSpell(id int) {
 	err := spellStore.Save(id, spells[id])
 	if err != nil {
 		log.Printf("error saving spell %03d (%s)\n", id, err)
+		return
 	}
+
+	clearDirty(ContentSpells, id)
 }
 
-// SaveAllSpells saves the data of all spells to the backing file store.
+// SaveAllSpells saves the data of all spells to the content store.
 func SaveAllSpells() {
 	for i := 0; i < config.MaxSpells; i++ {
 		SaveSpell(i)
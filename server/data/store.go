@@ -0,0 +1,84 @@
+package data
+
+import (
+	"database/sql"
+	"log"
+	"path"
+
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/database"
+	"github.com/guthius/mirage-nova/storage"
+)
+
+// Backends in which game content can be stored, as selected by ContentBackend.
+const (
+	BackendGob    = "gob"
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+)
+
+var contentDb *sql.DB
+
+// Load loads the classes and opens the content stores, loading all game content from them.
+// It must be called before any of the game content is used.
+func Load() error {
+	var err error
+
+	classes, err = loadClasses()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d classes\n", len(classes))
+
+	loadItems()
+	loadNpcs()
+	loadShops()
+	loadSpells()
+	loadLevels()
+
+	return nil
+}
+
+// newStore returns the store for the content with the specified name in the backend selected by ContentBackend.
+// File based backends keep the records in data/<name>, named after the prefix; the SQLite backend uses the table <name>.
+func newStore[K any](name string, prefix string, reset func(*K)) storage.Store[K] {
+	switch config.ContentBackend {
+	case BackendGob:
+		return storage.NewFileStore(path.Join("data", name), prefix, reset).SetBackups(config.ContentBackups)
+
+	case BackendJSON:
+		return storage.NewJSONFileStore(path.Join("data", name), prefix, reset).SetBackups(config.ContentBackups)
+
+	case BackendSQLite:
+		if contentDb == nil {
+			db, err := database.Open(config.ContentDatabase)
+			if err != nil {
+				log.Fatal(err)
+			}
+			contentDb = db
+		}
+
+		store, err := storage.NewSQLiteStore(contentDb, name, reset)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return store
+	}
+
+	log.Fatalf("unknown content backend '%s'\n", config.ContentBackend)
+	return nil
+}
+
+// loadRecord loads the record with the specified ID from the store.
+// When the record can not be loaded, the error is logged and a record with default values is used instead.
+func loadRecord[K any](store storage.Store[K], name string, id int, reset func(*K)) *K {
+	record, err := store.Load(id)
+	if err != nil {
+		log.Printf("error loading %s %03d (%s)\n", name, id, err)
+
+		record = new(K)
+		reset(record)
+	}
+	return record
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/guthius/mirage-nova/server/config"
+)
+
+// Severity tells how serious a problem in the game content is.
+type Severity int
+
+const (
+	SeverityError   Severity = iota // The content is broken, like a reference to a record that does not exist.
+	SeverityWarning                 // The content works, but is probably not what was intended, like a record without a name.
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Problem describes an issue found in the game content.
+type Problem struct {
+	Severity Severity
+	Content  ContentType
+	Id       int
+	Message  string
+}
+
+var contentNames = [contentTypeCount]string{
+	ContentItems:  "item",
+	ContentNpcs:   "npc",
+	ContentShops:  "shop",
+	ContentSpells: "spell",
+	ContentLevels: "level",
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s %03d: %s", p.Severity, contentNames[p.Content], p.Id, p.Message)
+}
+
+// validator collects the problems found in the game content.
+type validator struct {
+	problems []Problem
+}
+
+// report records an error, which is a problem that breaks the game content.
+func (v *validator) report(contentType ContentType, id int, format string, args ...any) {
+	v.add(SeverityError, contentType, id, format, args...)
+}
+
+// warn records a warning, which is a problem that does not break the game content.
+func (v *validator) warn(contentType ContentType, id int, format string, args ...any) {
+	v.add(SeverityWarning, contentType, id, format, args...)
+}
+
+func (v *validator) add(severity Severity, contentType ContentType, id int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{
+		Severity: severity,
+		Content:  contentType,
+		Id:       id,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the game content in use for references to records that do not exist or are empty,
+// coordinates that are outside of their level, levels that can not be reached from the start level,
+// and records that have data but no name. It returns the problems that were found; the last two are warnings.
+func Validate() []Problem {
+	v := &validator{}
+
+	for i, item := range items {
+		v.checkName(ContentItems, i, item.Name, isEmpty(item, resetItemData))
+	}
+
+	for i, npc := range npcs {
+		if isEmpty(npc, resetNpcData) {
+			continue
+		}
+		v.checkName(ContentNpcs, i, npc.Name, false)
+		if npc.DropItemId != -1 || npc.DropChance > 0 {
+			v.checkRef(ContentNpcs, i, "drop item", ContentItems, npc.DropItemId)
+		}
+	}
+
+	for i, shop := range shops {
+		if isEmpty(shop, resetShopData) {
+			continue
+		}
+		v.checkName(ContentShops, i, shop.Name, false)
+		for j, trade := range shop.TradeItems {
+			if trade.GiveItemId == -1 && trade.GetItemId == -1 {
+				continue
+			}
+			v.checkRef(ContentShops, i, fmt.Sprintf("trade %d gives", j+1), ContentItems, trade.GiveItemId)
+			v.checkRef(ContentShops, i, fmt.Sprintf("trade %d takes", j+1), ContentItems, trade.GetItemId)
+		}
+	}
+
+	for i, spell := range spells {
+		v.checkName(ContentSpells, i, spell.Name, isEmpty(spell, resetSpellData))
+	}
+
+	for i, level := range levels {
+		if isEmpty(level, resetLevelData) {
+			continue
+		}
+		v.checkName(ContentLevels, i, level.Name, false)
+		v.checkLevel(i, level)
+	}
+
+	v.checkStart()
+	v.checkReachable()
+
+	return v.problems
+}
+
+// isEmpty returns true if the record has its default values.
+func isEmpty[K any](record *K, reset func(*K)) bool {
+	empty := new(K)
+	reset(empty)
+	return reflect.DeepEqual(record, empty)
+}
+
+// isEmptyRecord returns true if the record of the specified content type and ID has its default values.
+func isEmptyRecord(contentType ContentType, id int) bool {
+	switch contentType {
+	case ContentItems:
+		return isEmpty(items[id], resetItemData)
+	case ContentNpcs:
+		return isEmpty(npcs[id], resetNpcData)
+	case ContentShops:
+		return isEmpty(shops[id], resetShopData)
+	case ContentSpells:
+		return isEmpty(spells[id], resetSpellData)
+	case ContentLevels:
+		return isEmpty(levels[id], resetLevelData)
+	}
+	return true
+}
+
+var contentCounts = [contentTypeCount]int{
+	ContentItems:  config.MaxItems,
+	ContentNpcs:   config.MaxNpcs,
+	ContentShops:  config.MaxShops,
+	ContentSpells: config.MaxSpells,
+	ContentLevels: config.MaxMaps,
+}
+
+// checkName reports records that have data but no name, as they are not sent to players.
+func (v *validator) checkName(contentType ContentType, id int, name string, empty bool) {
+	if !empty && len(name) == 0 {
+		v.warn(contentType, id, "has no name")
+	}
+}
+
+// checkRef reports a reference to a record that does not exist or is empty.
+// It returns true if the reference is valid.
+func (v *validator) checkRef(contentType ContentType, id int, field string, refType ContentType, refId int) bool {
+	if refId < 0 || refId >= contentCounts[refType] {
+		v.report(contentType, id, "%s refers to %s %d, which does not exist", field, contentNames[refType], refId)
+		return false
+	}
+	if isEmptyRecord(refType, refId) {
+		v.report(contentType, id, "%s refers to %s %03d, which is empty", field, contentNames[refType], refId)
+		return false
+	}
+	return true
+}
+
+// checkOptionalRef is like checkRef, but also accepts -1 for no reference.
+func (v *validator) checkOptionalRef(contentType ContentType, id int, field string, refType ContentType, refId int) bool {
+	if refId == -1 {
+		return false
+	}
+	return v.checkRef(contentType, id, field, refType, refId)
+}
+
+// checkPosition reports a position that is outside of the specified level.
+func (v *validator) checkPosition(id int, field string, levelId int, x int, y int) {
+	if !levels[levelId].Contains(x, y) {
+		v.report(ContentLevels, id, "%s is at (%d, %d), which is outside of level %03d", field, x, y, levelId)
+	}
+}
+
+func (v *validator) checkLevel(id int, level *LevelData) {
+	if !level.hasValidSize() {
+		v.report(ContentLevels, id, "size %dx%d is not between 1x1 and %dx%d", level.Width, level.Height, maxWidth, maxHeight)
+		return
+	}
+
+	v.checkOptionalRef(ContentLevels, id, "up", ContentLevels, level.Up)
+	v.checkOptionalRef(ContentLevels, id, "down", ContentLevels, level.Down)
+	v.checkOptionalRef(ContentLevels, id, "left", ContentLevels, level.Left)
+	v.checkOptionalRef(ContentLevels, id, "right", ContentLevels, level.Right)
+	v.checkOptionalRef(ContentLevels, id, "shop", ContentShops, level.Shop)
+
+	if v.checkOptionalRef(ContentLevels, id, "boot map", ContentLevels, level.BootMap) {
+		v.checkPosition(id, "boot position", level.BootMap, level.BootX, level.BootY)
+	}
+
+	for i, npc := range level.Npcs {
+		v.checkOptionalRef(ContentLevels, id, fmt.Sprintf("npc %d", i+1), ContentNpcs, npc)
+	}
+
+	for y := 0; y < level.Height; y++ {
+		for x := 0; x < level.Width; x++ {
+			tile := level.GetTile(x, y)
+			switch tile.Type {
+			case TileTypeWarp:
+				if v.checkRef(ContentLevels, id, fmt.Sprintf("warp at (%d, %d)", x, y), ContentLevels, tile.Data1) {
+					v.checkPosition(id, fmt.Sprintf("destination of warp at (%d, %d)", x, y), tile.Data1, tile.Data2, tile.Data3)
+				}
+
+			case TileTypeKeyOpen:
+				v.checkPosition(id, fmt.Sprintf("door of key at (%d, %d)", x, y), id, tile.Data1, tile.Data2)
+			}
+		}
+	}
+}
+
+// hasValidSize returns true if all tiles within the width and height of the level exist.
+func (level *LevelData) hasValidSize() bool {
+	return level.Width >= 1 && level.Width <= maxWidth && level.Height >= 1 && level.Height <= maxHeight
+}
+
+// checkStart reports a start position for new characters that is outside of the start level.
+func (v *validator) checkStart() {
+	if config.StartRoom < 0 || config.StartRoom >= config.MaxMaps {
+		v.report(ContentLevels, config.StartRoom, "is the start level, which does not exist")
+		return
+	}
+	v.checkPosition(config.StartRoom, "start position", config.StartRoom, config.StartX, config.StartY)
+}
+
+// checkReachable reports levels that players can not get to from the start level
+// by walking off the edge of a level, using a warp or being booted.
+func (v *validator) checkReachable() {
+	if config.StartRoom < 0 || config.StartRoom >= config.MaxMaps {
+		return
+	}
+
+	var reached [config.MaxMaps]bool
+
+	pending := []int{config.StartRoom}
+	reached[config.StartRoom] = true
+
+	visit := func(id int) {
+		if id >= 0 && id < config.MaxMaps && !reached[id] {
+			reached[id] = true
+			pending = append(pending, id)
+		}
+	}
+
+	for len(pending) > 0 {
+		level := levels[pending[0]]
+		pending = pending[1:]
+
+		visit(level.Up)
+		visit(level.Down)
+		visit(level.Left)
+		visit(level.Right)
+		visit(level.BootMap)
+
+		if !level.hasValidSize() {
+			continue
+		}
+
+		for y := 0; y < level.Height; y++ {
+			for x := 0; x < level.Width; x++ {
+				if tile := level.GetTile(x, y); tile.Type == TileTypeWarp {
+					visit(tile.Data1)
+				}
+			}
+		}
+	}
+
+	for i, level := range levels {
+		if !reached[i] && !isEmpty(level, resetLevelData) {
+			v.warn(ContentLevels, i, "can not be reached from the start level %03d", config.StartRoom)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package data
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/guthius/mirage-nova/server/config"
+)
+
+// useEmptyContent replaces the content in use with empty records for the duration of the test.
+func useEmptyContent(t *testing.T) {
+	oldItems, oldNpcs, oldShops, oldSpells, oldLevels := items, npcs, shops, spells, levels
+	t.Cleanup(func() {
+		items, npcs, shops, spells, levels = oldItems, oldNpcs, oldShops, oldSpells, oldLevels
+	})
+
+	for i := range items {
+		items[i] = new(ItemData)
+		resetItemData(items[i])
+	}
+	for i := range npcs {
+		npcs[i] = new(NpcData)
+		resetNpcData(npcs[i])
+	}
+	for i := range shops {
+		shops[i] = new(ShopData)
+		resetShopData(shops[i])
+	}
+	for i := range spells {
+		spells[i] = new(SpellData)
+		resetSpellData(spells[i])
+	}
+	for i := range levels {
+		levels[i] = new(LevelData)
+		resetLevelData(levels[i])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const start = config.StartRoom
+
+	tests := []struct {
+		name  string
+		setup func()
+		want  []string
+	}{
+		{"empty content", func() {}, nil},
+		{
+			"item without name",
+			func() { items[3].Pic = 1 },
+			[]string{"warning: item 003: has no name"},
+		},
+		{
+			"spell without name",
+			func() { spells[2].Type = 1 },
+			[]string{"warning: spell 002: has no name"},
+		},
+		{
+			"npc drops empty item",
+			func() {
+				npcs[1].Name = "Rat"
+				npcs[1].DropItemId = 4
+			},
+			[]string{"error: npc 001: drop item refers to item 004, which is empty"},
+		},
+		{
+			"npc drops item that does not exist",
+			func() {
+				npcs[1].Name = "Rat"
+				npcs[1].DropItemId = config.MaxItems
+			},
+			[]string{"error: npc 001: drop item refers to item 255, which does not exist"},
+		},
+		{
+			"npc drops item",
+			func() {
+				items[4].Name = "Tail"
+				npcs[1].Name = "Rat"
+				npcs[1].DropItemId = 4
+			},
+			nil,
+		},
+		{
+			"shop trades empty item",
+			func() {
+				items[1].Name = "Gold"
+				shops[0].Name = "Shop"
+				shops[0].TradeItems[2].GiveItemId = 1
+				shops[0].TradeItems[2].GetItemId = 2
+			},
+			[]string{"error: shop 000: trade 3 takes refers to item 002, which is empty"},
+		},
+		{
+			"level without name",
+			func() { levels[start].Music = 1 },
+			[]string{"warning: level 005: has no name"},
+		},
+		{
+			"invalid level size",
+			func() {
+				levels[start].Name = "Start"
+				levels[start].Width = 0
+			},
+			[]string{
+				"error: level 005: size 0x12 is not between 1x1 and 16x12",
+				"error: level 005: start position is at (5, 8), which is outside of level 005",
+			},
+		},
+		{
+			"edge refers to empty level",
+			func() {
+				levels[start].Name = "Start"
+				levels[start].Right = 6
+			},
+			[]string{"error: level 005: right refers to level 006, which is empty"},
+		},
+		{
+			"warp outside of destination",
+			func() {
+				levels[start].Name = "Start"
+				levels[start].GetTile(0, 0).Type = TileTypeWarp
+				levels[start].GetTile(0, 0).Data1 = 6
+				levels[start].GetTile(0, 0).Data2 = 16
+				levels[6].Name = "Destination"
+			},
+			[]string{"error: level 005: destination of warp at (0, 0) is at (16, 0), which is outside of level 006"},
+		},
+		{
+			"key opens door outside of level",
+			func() {
+				levels[start].Name = "Start"
+				levels[start].GetTile(1, 0).Type = TileTypeKeyOpen
+				levels[start].GetTile(1, 0).Data1 = 3
+				levels[start].GetTile(1, 0).Data2 = 12
+			},
+			[]string{"error: level 005: door of key at (1, 0) is at (3, 12), which is outside of level 005"},
+		},
+		{
+			"unreachable level",
+			func() {
+				levels[start].Name = "Start"
+				levels[7].Name = "Island"
+			},
+			[]string{"warning: level 007: can not be reached from the start level 005"},
+		},
+		{
+			"levels reached by edge, warp and boot map",
+			func() {
+				levels[start].Name = "Start"
+				levels[start].Right = 6
+				levels[6].Name = "East"
+				levels[6].GetTile(2, 2).Type = TileTypeWarp
+				levels[6].GetTile(2, 2).Data1 = 7
+				levels[7].Name = "Warped"
+				levels[7].BootMap = 8
+				levels[8].Name = "Booted"
+			},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		useEmptyContent(t)
+		tt.setup()
+
+		var got []string
+		for _, problem := range Validate() {
+			got = append(got, problem.String())
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Validate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/guthius/mirage-nova/server/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens the SQLite database at the specified path and verifies that it can be used.
+// The returned handle is a pool of connections that is meant to be kept open for the lifetime of the server.
+//
+// The database uses write-ahead logging so reads do not block writes, enforces foreign keys,
+// and waits for up to DatabaseBusyTimeout milliseconds when it is locked by another connection.
+func Open(path string) (*sql.DB, error) {
+	query := url.Values{}
+	query.Set("_journal_mode", "WAL")
+	query.Set("_synchronous", "NORMAL")
+	query.Set("_busy_timeout", fmt.Sprint(config.DatabaseBusyTimeout))
+	query.Set("_foreign_keys", "on")
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := Context()
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Context returns a context that cancels a query once it takes longer than DatabaseQueryTimeout seconds.
+func Context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), config.DatabaseQueryTimeout*time.Second)
+}
+
+// Statements prepares statements on a database and keeps track of them, so they can be reused and closed together.
+// Once preparing a statement has failed, all subsequent calls to Prepare do nothing and the error is returned by Err.
+type Statements struct {
+	db    *sql.DB
+	stmts []*sql.Stmt
+	err   error
+}
+
+// NewStatements returns a new set of statements for the specified database.
+func NewStatements(db *sql.DB) *Statements {
+	return &Statements{db: db}
+}
+
+// Prepare prepares the specified query and returns the statement, or nil if an error has occurred.
+func (s *Statements) Prepare(ctx context.Context, query string) *sql.Stmt {
+	if s.err != nil {
+		return nil
+	}
+
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		s.err = err
+		return nil
+	}
+
+	s.stmts = append(s.stmts, stmt)
+
+	return stmt
+}
+
+// Err returns the first error that occurred while preparing statements.
+func (s *Statements) Err() error {
+	return s.err
+}
+
+// Close closes all statements that have been prepared.
+func (s *Statements) Close() error {
+	var err error
+	for _, stmt := range s.stmts {
+		err = errors.Join(err, stmt.Close())
+	}
+
+	s.stmts = nil
+
+	return err
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Migration describes a single change to the schema of a database.
+// Migrations are numbered from 1 and are applied in order, each in its own transaction.
+// A migration must never be changed once it has been released; add a new migration instead.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Exec returns a migration function that executes the specified queries in order.
+func Exec(queries ...string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, query := range queries {
+			_, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+const createSchemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`
+
+// Version returns the version of the schema of the database, which is zero when no migrations have been applied.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	_, err := db.ExecContext(ctx, createSchemaVersionTable)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Migrate applies all migrations that have not been applied to the database yet and returns the ones that were applied.
+// When a migration fails, its changes are rolled back and no further migrations are applied.
+func Migrate(ctx context.Context, db *sql.DB, migrations []Migration) ([]Migration, error) {
+	err := checkMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := Version(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > len(migrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than the newest known version %d", version, len(migrations))
+	}
+
+	applied := make([]Migration, 0, len(migrations)-version)
+
+	for _, m := range migrations[version:] {
+		err = apply(ctx, db, m)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// CheckVersion returns an error if the schema of the database is not at the version of the newest migration.
+func CheckVersion(ctx context.Context, db *sql.DB, migrations []Migration) error {
+	version, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version < len(migrations):
+		return fmt.Errorf("database schema version %d is out of date, version %d is required; run the migrate command to update it", version, len(migrations))
+	case version > len(migrations):
+		return fmt.Errorf("database schema version %d is newer than the newest known version %d", version, len(migrations))
+	}
+
+	return nil
+}
+
+// checkMigrations makes sure the migrations are numbered in order, starting from 1.
+func checkMigrations(migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, expected version %d", m.Description, m.Version, i+1)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = m.Up(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_version (version, description) VALUES (?, ?)", m.Version, m.Description)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := Open(path.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+var errMigrationFailed = errors.New("migration failed")
+
+var testMigrations = []Migration{
+	{1, "create table", Exec("CREATE TABLE test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")},
+	{2, "add column", Exec("ALTER TABLE test ADD COLUMN level INTEGER NOT NULL DEFAULT 1")},
+	{3, "insert row", Exec("INSERT INTO test (name) VALUES ('first')")},
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      int // The number of migrations that were applied before.
+		migrations  []Migration
+		wantApplied []int
+		wantVersion int
+		wantErr     string
+	}{
+		{"new database", 0, testMigrations, []int{1, 2, 3}, 3, ""},
+		{"partially migrated", 1, testMigrations, []int{2, 3}, 3, ""},
+		{"up to date", 3, testMigrations, nil, 3, ""},
+		{"no migrations", 0, nil, nil, 0, ""},
+		{
+			"newer database",
+			3,
+			testMigrations[:2],
+			nil,
+			3,
+			"database schema version 3 is newer than the newest known version 2",
+		},
+		{
+			"out of order",
+			0,
+			[]Migration{testMigrations[0], testMigrations[2]},
+			nil,
+			0,
+			`migration "insert row" has version 3, expected version 2`,
+		},
+		{
+			"failing migration",
+			0,
+			[]Migration{
+				testMigrations[0],
+				{2, "fails", func(ctx context.Context, tx *sql.Tx) error {
+					if _, err := tx.ExecContext(ctx, "INSERT INTO test (name) VALUES ('rolled back')"); err != nil {
+						return err
+					}
+					return errMigrationFailed
+				}},
+				testMigrations[2],
+			},
+			[]int{1},
+			1,
+			"migration 2 (fails): migration failed",
+		},
+		{
+			"failing query",
+			0,
+			[]Migration{{1, "invalid", Exec("CREATE TABLE valid (id INTEGER)", "NOT SQL")}},
+			nil,
+			0,
+			"migration 1 (invalid):",
+		},
+	}
+
+	for _, tt := range tests {
+		db := openTestDatabase(t)
+		ctx := context.Background()
+
+		if _, err := Migrate(ctx, db, testMigrations[:tt.before]); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		applied, err := Migrate(ctx, db, tt.migrations)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: Migrate returned error %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+			t.Errorf("%s: Migrate returned error %v, want one starting with %q", tt.name, err, tt.wantErr)
+		}
+
+		var versions []int
+		for _, m := range applied {
+			versions = append(versions, m.Version)
+		}
+		if !slices.Equal(versions, tt.wantApplied) {
+			t.Errorf("%s: applied migrations %v, want %v", tt.name, versions, tt.wantApplied)
+		}
+
+		version, err := Version(ctx, db)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if version != tt.wantVersion {
+			t.Errorf("%s: schema version is %d, want %d", tt.name, version, tt.wantVersion)
+		}
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db := openTestDatabase(t)
+	ctx := context.Background()
+
+	migrations := []Migration{
+		testMigrations[0],
+		{2, "partial", Exec("CREATE TABLE partial (id INTEGER)", "INSERT INTO test (name) VALUES ('partial')", "NOT SQL")},
+	}
+
+	if _, err := Migrate(ctx, db, migrations); err == nil {
+		t.Fatal("the failing migration did not return an error")
+	}
+
+	if tableExists(t, db, "partial") {
+		t.Error("the table created by the failed migration exists")
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM test").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("the failed migration inserted %d rows", count)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied int
+		known   int
+		wantErr string
+	}{
+		{"up to date", 3, 3, ""},
+		{"new database", 0, 0, ""},
+		{"out of date", 1, 3, "database schema version 1 is out of date, version 3 is required"},
+		{"newer", 3, 2, "database schema version 3 is newer than the newest known version 2"},
+	}
+
+	for _, tt := range tests {
+		db := openTestDatabase(t)
+		ctx := context.Background()
+
+		if _, err := Migrate(ctx, db, testMigrations[:tt.applied]); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		err := CheckVersion(ctx, db, testMigrations[:tt.known])
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: CheckVersion returned error %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+			t.Errorf("%s: CheckVersion returned error %v, want one starting with %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -64,6 +64,13 @@ const (
 	SvLimits
 	SSync
 	SvMapRevisions
+	SvHandshake
+	SvContentManifest
+	SvItems
+	SvNpcs
+	SvShops
+	SvSpells
+	SvPing
 )
 
 const (
@@ -139,6 +146,10 @@ const (
 	CKickGuild
 	CGuildPromote
 	CLeaveGuild
+	ClHandshake
+	ClRequestContent
+	ClPong
+	ClReloadContent
 
 	MaxClientPacketId
 )
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/utils"
+)
+
+// Command is a unit of work that is executed on the game loop.
+type Command func()
+
+type gameTimer struct {
+	interval int64
+	next     int64
+	callback func(now int64)
+}
+
+var timers []*gameTimer
+var gameLoopStopped = false
+
+// The commands and events waiting for the game loop are kept in a single queue, so they are executed in the order
+// in which they were queued. The packets of a connection are therefore always handled before its disconnect.
+var (
+	queueMu        sync.Mutex
+	queue          []Command
+	queuedCommands int // The number of commands in the queue that were queued by QueueCommand.
+)
+
+// QueueCommand queues the specified command for execution on the game loop.
+// It never blocks; when MaxQueuedCommands commands are waiting already, the command is dropped and false is returned.
+// It is safe to call QueueCommand from any goroutine, but it must not be called from the game loop,
+// which can simply execute the command itself.
+func QueueCommand(cmd Command) bool {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	if queuedCommands >= config.MaxQueuedCommands {
+		return false
+	}
+
+	queuedCommands++
+	queue = append(queue, cmd)
+
+	return true
+}
+
+// QueueEvent queues a command that must not be dropped, like handling a connection that was opened or closed.
+// Events do not count towards the limit of QueueCommand and are executed in order with the queued commands.
+// It never blocks and it is safe to call QueueEvent from any goroutine, but it must not be called from the game loop.
+func QueueEvent(cmd Command) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	queue = append(queue, cmd)
+}
+
+// AddTimer registers a callback that is invoked on the game loop each time the specified interval has elapsed.
+// The callback receives the current tick count in milliseconds.
+func AddTimer(interval time.Duration, callback func(now int64)) {
+	timers = append(timers, &gameTimer{
+		interval: interval.Milliseconds(),
+		next:     utils.GetTickCount() + interval.Milliseconds(),
+		callback: callback,
+	})
+}
+
+// RunGameLoop runs the game loop on the calling goroutine until StopGameLoop is called.
+// All game state must only be modified from within the game loop.
+func RunGameLoop() {
+	ticker := time.NewTicker(time.Second / config.TickRate)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		tick()
+		if gameLoopStopped {
+			return
+		}
+	}
+}
+
+// StopGameLoop stops the game loop at the end of the current tick. It must be called from within the game loop.
+func StopGameLoop() {
+	gameLoopStopped = true
+}
+
+// tick executes all queued events and commands, followed by all timers that are due.
+func tick() {
+	// Only execute the commands that were queued before the tick started,
+	// so a flood of incoming commands can not starve the timers
+	queueMu.Lock()
+	pending := queue
+	queue = nil
+	queuedCommands = 0
+	queueMu.Unlock()
+
+	for _, cmd := range pending {
+		cmd()
+	}
+
+	now := utils.GetTickCount()
+	for _, t := range timers {
+		if now < t.next {
+			continue
+		}
+		t.next = now + t.interval
+		t.callback(now)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/guthius/mirage-nova/server/config"
+)
+
+// blockGameLoop keeps the game loop of the test server busy until the returned function is called.
+func blockGameLoop() (release func()) {
+	blocked := make(chan struct{})
+	done := make(chan struct{})
+
+	QueueEvent(func() {
+		close(blocked)
+		<-done
+	})
+	<-blocked
+
+	return func() { close(done) }
+}
+
+func TestCommandsAndEventsRunInOrder(t *testing.T) {
+	var order []int
+
+	release := blockGameLoop()
+	for i := 1; i <= 6; i++ {
+		if i%2 == 0 {
+			QueueEvent(func() { order = append(order, i) })
+		} else if !QueueCommand(func() { order = append(order, i) }) {
+			t.Fatal("the command could not be queued")
+		}
+	}
+	release()
+
+	runOnGameLoop(func() {})
+
+	if want := []int{1, 2, 3, 4, 5, 6}; !slices.Equal(order, want) {
+		t.Errorf("commands and events ran in order %v, want %v", order, want)
+	}
+}
+
+func TestQueueCommandDropsWhenFull(t *testing.T) {
+	ran := 0
+
+	release := blockGameLoop()
+	queued := 0
+	for QueueCommand(func() { ran++ }) {
+		queued++
+	}
+
+	// Events are never dropped, even when the command queue is full
+	QueueEvent(func() { ran++ })
+	release()
+
+	runOnGameLoop(func() {})
+
+	if queued != config.MaxQueuedCommands {
+		t.Errorf("%d commands were queued before the queue was full, want %d", queued, config.MaxQueuedCommands)
+	}
+	if ran != queued+1 {
+		t.Errorf("%d commands and events ran, want %d", ran, queued+1)
+	}
+}
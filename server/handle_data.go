@@ -1,17 +1,17 @@
 ﻿package main
 
 import (
-	"encoding/binary"
 	"fmt"
 	"log"
-	"strings"
-	"unicode/utf16"
+	"time"
 
 	"github.com/guthius/mirage-nova/net"
 	"github.com/guthius/mirage-nova/server/character"
+	"github.com/guthius/mirage-nova/server/color"
 	"github.com/guthius/mirage-nova/server/common"
 	"github.com/guthius/mirage-nova/server/config"
 	"github.com/guthius/mirage-nova/server/data"
+	"github.com/guthius/mirage-nova/server/database"
 	"github.com/guthius/mirage-nova/server/user"
 	"github.com/guthius/mirage-nova/server/utils"
 )
@@ -21,17 +21,56 @@ type PacketHandler func(player *PlayerData, reader *net.PacketReader)
 var PacketHandlers [MaxClientPacketId]PacketHandler
 
 func init() {
-	PacketHandlers[ClGetClasses] = HandleGetClasses
-	PacketHandlers[ClCreateAccount] = HandleCreateAccount
-	PacketHandlers[ClLogin] = HandleLogin
-	PacketHandlers[ClCreateCharacter] = HandleCreateCharacter
-	PacketHandlers[ClDeleteCharacter] = HandleDeleteCharacter
-	PacketHandlers[ClSelectCharacter] = HandleSelectCharacter
-	PacketHandlers[ClPlayerMove] = HandlePlayerMove
-	PacketHandlers[ClRequestNewLevel] = HandleRequestNewLevel
-	PacketHandlers[ClLevelData] = HandleLevelData
-	PacketHandlers[ClNeedLevel] = HandleNeedLevel
-	PacketHandlers[ClRequestEditLevel] = HandleRequestEditLevel
+	registerHandler(HandleHandshake)
+	registerHandler(HandleGetClasses)
+	registerHandler(HandleCreateAccount)
+	registerHandler(HandleLogin)
+	registerHandler(HandleCreateCharacter)
+	registerHandler(HandleDeleteCharacter)
+	registerHandler(HandleSelectCharacter)
+	registerHandler(HandlePlayerMove)
+	registerHandler(HandleRequestNewLevel)
+	registerHandler(HandleLevelData)
+	registerHandler(HandleNeedLevel)
+	registerHandler(HandleRequestEditLevel)
+	registerHandler(HandleRequestContent)
+	registerHandler(HandlePong)
+	registerHandler(HandleReloadContent)
+}
+
+// runInBackground runs slow work for the player, like hashing passwords and querying the database, on a separate
+// goroutine so it does not stall the game loop. The function returned by the work is executed on the game loop,
+// unless the player has lost their connection in the meantime. Requests that are made while the player is busy are ignored.
+func runInBackground(player *PlayerData, work func() func()) {
+	conn := player.Connection
+	player.busy = true
+
+	go func() {
+		apply := work()
+
+		QueueEvent(func() {
+			if player.Connection != conn {
+				return
+			}
+			player.busy = false
+			apply()
+		})
+	}()
+}
+
+// registerHandler registers the handler for the packet type P.
+// The packet is decoded before the handler is invoked, and the handler is not invoked when the packet is malformed.
+func registerHandler[T any, P interface {
+	*T
+	net.Packet
+}](handler func(player *PlayerData, packet P)) {
+	PacketHandlers[P(new(T)).PacketId()] = func(player *PlayerData, reader *net.PacketReader) {
+		packet := P(new(T))
+		if reader.ReadPacket(packet) != nil {
+			return
+		}
+		handler(player, packet)
+	}
 }
 
 func HandlePacket(player *PlayerData, reader *net.PacketReader) {
@@ -49,14 +88,65 @@ func HandlePacket(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
+	// Drop packets that exceed their budget
+	now := utils.GetTickCount()
+	if !player.rateLimiter.allow(packetId, now) {
+		HandleFlood(player, packetId, now)
+		return
+	}
+
+	// Decode the packet using the protocol version negotiated with the client
+	reader.SetVersion(player.Protocol)
+
 	packetHandler(player, reader)
+
+	// Disconnect clients that send malformed packets
+	if err := reader.Err(); err != nil {
+		ReportHack(player, fmt.Sprintf("malformed packet %d (%s)", packetId, err))
+	}
+}
+
+// ::::::::::::::::::::::
+// :: Handshake packet ::
+// ::::::::::::::::::::::
+
+func HandleHandshake(player *PlayerData, packet *ClHandshakePacket) {
+	if player.Handshaked || player.IsLoggedIn() {
+		return
+	}
+
+	version, ok := negotiateVersion(packet.MinVersion, packet.MaxVersion)
+	if !ok {
+		log.Printf("[%d] Client does not support any of the protocol versions %d-%d\n",
+			player.Id, config.MinProtocolVersion, config.ProtocolVersion)
+
+		SendOutdated(player)
+		return
+	}
+
+	player.Protocol = version
+	player.Capabilities = packet.Capabilities & ServerCapabilities
+	player.Handshaked = true
+
+	// The client only sends compressed frames after it has received the reply, so the frames it sends until then are parsed as before
+	player.Connection.SetCompression(player.Capabilities.Has(CapCompression))
+
+	// Clients that send heartbeats are expected to never be idle for long
+	if player.Capabilities.Has(CapHeartbeat) {
+		player.Connection.SetIdleTimeout(config.HeartbeatTimeout * time.Second)
+	}
+
+	player.SendPacket(&SvHandshakePacket{
+		Version:      player.Protocol,
+		Capabilities: player.Capabilities,
+	})
 }
 
 // :::::::::::::::::::::::::::::::::::::::::::::::
 // :: Requesting classes for making a character ::
 // :::::::::::::::::::::::::::::::::::::::::::::::
 
-func HandleGetClasses(player *PlayerData, _ *net.PacketReader) {
+func HandleGetClasses(player *PlayerData, _ *ClGetClassesPacket) {
 	if !player.IsPlaying() {
 		SendNewCharClasses(player)
 	}
@@ -66,14 +156,13 @@ func HandleGetClasses(player *PlayerData, _ *net.PacketReader) {
 // :: New account packet ::
 // ::::::::::::::::::::::::
 
-func HandleCreateAccount(player *PlayerData, reader *net.PacketReader) {
-	if player.IsLoggedIn() {
+func HandleCreateAccount(player *PlayerData, packet *ClCreateAccountPacket) {
+	if player.IsLoggedIn() || player.busy {
 		return
 	}
 
-	// Get the data
-	accountName := reader.ReadString()
-	password := reader.ReadString()
+	accountName := packet.Name
+	password := packet.Password
 
 	// Make sure the account name length is valid
 	if len(accountName) < 3 || len(accountName) > 20 {
@@ -93,42 +182,51 @@ func HandleCreateAccount(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
-	// Make sure the account name is not already taken
-	if user.Exists(accountName) {
-		SendAlert(player, "Sorry, that account name is already taken!")
-		return
-	}
+	remoteAddr := player.Connection.RemoteAddr()
 
-	_, ok := user.Create(accountName, password, player.Connection.RemoteAddr())
-	if !ok {
-		SendAlert(player, "There was an problem creating your account. Please try again later.")
-		return
-	}
+	runInBackground(player, func() func() {
+		ctx, cancel := database.Context()
+		defer cancel()
+
+		// Make sure the account name is not already taken
+		if accountStore.Exists(ctx, accountName) {
+			return func() {
+				SendAlert(player, "Sorry, that account name is already taken!")
+			}
+		}
+
+		_, ok := accountStore.Create(ctx, accountName, password, remoteAddr)
 
-	log.Printf("[%d] Account '%s' has been created\n", player.Id, accountName)
+		return func() {
+			if !ok {
+				SendAlert(player, "There was an problem creating your account. Please try again later.")
+				return
+			}
 
-	SendAlert(player, "Your account has been created!")
+			log.Printf("[%d] Account '%s' has been created\n", player.Id, accountName)
+
+			SendAlert(player, "Your account has been created!")
+		}
+	})
 }
 
 // ::::::::::::::::::
 // :: Login packet ::
 // ::::::::::::::::::
 
-func HandleLogin(player *PlayerData, reader *net.PacketReader) {
-	if player.IsLoggedIn() {
+func HandleLogin(player *PlayerData, packet *ClLoginPacket) {
+	if player.IsLoggedIn() || player.busy {
 		return
 	}
 
-	// Get the account data
-	accountName := reader.ReadString()
-	password := reader.ReadString()
+	accountName := packet.Name
+	password := packet.Password
 
-	// Make sure client version is correct
-	if reader.ReadByte() != config.VersionMajor || reader.ReadByte() != config.VersionMinor || reader.ReadByte() != config.VersionRevision {
-		SendAlert(player, fmt.Sprintf(
-			"Your client is outdated.\n\n"+
-				"To continue, please update to the latest version.\n\n"+
-				"Download the latest version from %s.", config.GameWebsite))
+	// Clients that did not negotiate a protocol version must have the exact same version as the server
+	if !player.Handshaked && (packet.VersionMajor != config.VersionMajor ||
+		packet.VersionMinor != config.VersionMinor ||
+		packet.VersionRevision != config.VersionRevision) {
+		SendOutdated(player)
 		return
 	}
 
@@ -150,12 +248,34 @@ func HandleLogin(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
-	// Make sure the account exists and the password is correct
-	account := user.Load(accountName)
-	if account == nil || !account.IsPasswordCorrect(password) {
-		SendAlert(player, "That account name does not exist or the password is incorrect.")
-		return
-	}
+	// Characters that are still being saved must be written before they are loaded again
+	saved := pendingSaves()
+
+	runInBackground(player, func() func() {
+		<-saved
+
+		ctx, cancel := database.Context()
+		defer cancel()
+
+		// Make sure the account exists and the password is correct
+		account := accountStore.Load(ctx, accountName)
+		if account == nil || !account.IsPasswordCorrect(password) {
+			return func() {
+				SendAlert(player, "That account name does not exist or the password is incorrect.")
+			}
+		}
+
+		characters := characterStore.LoadCharactersForAccount(ctx, account.Id)
+
+		return func() {
+			completeLogin(player, account, characters)
+		}
+	})
+}
+
+// completeLogin logs the player in to the account, once the password has been verified and the characters have been loaded.
+func completeLogin(player *PlayerData, account *user.Account, characters []character.Character) {
+	accountName := account.Name
 
 	// Make sure the account is not already logged in
 	if IsAccountLoggedIn(accountName) {
@@ -163,10 +283,16 @@ func HandleLogin(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
-	characters := character.LoadCharactersForAccount(account.Id)
+	// Give players that lost their connection their session back
+	if session := FindSession(accountName); session != nil {
+		ResumeSession(player, session)
+		return
+	}
+
 	characterCount := len(characters)
 
 	player.Account = account
+	player.Connection.Authenticate()
 
 	for i := 0; i < config.MaxChars; i++ {
 		if i < characterCount {
@@ -187,15 +313,15 @@ func HandleLogin(player *PlayerData, reader *net.PacketReader) {
 // :: Add character packet ::
 // ::::::::::::::::::::::::::
 
-func HandleCreateCharacter(player *PlayerData, reader *net.PacketReader) {
-	if !player.IsLoggedIn() {
+func HandleCreateCharacter(player *PlayerData, packet *ClCreateCharacterPacket) {
+	if !player.IsLoggedIn() || player.busy {
 		return
 	}
 
-	characterName := reader.ReadString()
-	gender := character.Gender(reader.ReadLong())
-	classId := reader.ReadLong() - 1
-	slot := reader.ReadLong() - 1
+	characterName := packet.Name
+	gender := character.Gender(packet.Gender)
+	classId := packet.Class - 1
+	slot := packet.Slot - 1
 
 	if slot < 0 || slot >= len(player.CharacterList) {
 		ReportHack(player, "character slot out of range")
@@ -228,33 +354,45 @@ func HandleCreateCharacter(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
-	if character.Exists(characterName) {
-		SendAlert(player, "Sorry, but that name is in use!")
-		return
-	}
+	newCharacter := character.NewCharacter(player.Account.Id, characterName, gender, classId)
 
-	_, ok := character.CreateCharacter(player.Account.Id, characterName, gender, classId)
-	if !ok {
-		SendAlert(player, "There was an problem creating the character. Please try again later.")
-		return
-	}
+	runInBackground(player, func() func() {
+		ctx, cancel := database.Context()
+		defer cancel()
 
-	log.Printf("[%d] Character '%s' has been created by '%s' from %s\n",
-		player.Id,
-		characterName,
-		player.Account.Name,
-		player.Connection.RemoteAddr())
+		if characterStore.Exists(ctx, characterName) {
+			return func() {
+				SendAlert(player, "Sorry, but that name is in use!")
+			}
+		}
+
+		ok := characterStore.CreateCharacter(ctx, newCharacter)
+
+		return func() {
+			if !ok {
+				SendAlert(player, "There was an problem creating the character. Please try again later.")
+				return
+			}
+
+			log.Printf("[%d] Character '%s' has been created by '%s' from %s\n",
+				player.Id,
+				characterName,
+				player.Account.Name,
+				player.Connection.RemoteAddr())
 
-	SendAlert(player, "Character has been created!")
+			SendAlert(player, "Character has been created!")
+		}
+	})
 }
 
-func HandleDeleteCharacter(player *PlayerData, reader *net.PacketReader) {
-	if !player.IsLoggedIn() {
+func HandleDeleteCharacter(player *PlayerData, packet *ClDeleteCharacterPacket) {
+	if !player.IsLoggedIn() || player.busy {
 		return
 	}
 
 	// Get the index of the character slot to delete
-	slot := reader.ReadLong() - 1
+	slot := packet.Slot - 1
+
 	if slot < 0 || slot >= len(player.CharacterList) {
 		return
 	}
@@ -266,35 +404,60 @@ func HandleDeleteCharacter(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
-	character.Delete()
+	// The character is deleted from a copy, as the character list must only be modified on the game loop
+	deleted := *character
+
+	// A save of the character that is still queued must not write it back after it has been deleted
+	saved := pendingSaves()
+
+	runInBackground(player, func() func() {
+		<-saved
 
-	log.Printf("[%d] Character '%s' has been deleted by '%s' from %s\n",
-		player.Id,
-		character.Name,
-		player.Account.Name,
-		player.Connection.RemoteAddr())
+		ctx, cancel := database.Context()
+		defer cancel()
 
-	SendAlert(player, "Character has been deleted!")
+		ok := characterStore.Delete(ctx, &deleted)
+
+		return func() {
+			if !ok {
+				SendAlert(player, "There was an problem deleting the character. Please try again later.")
+				return
+			}
+
+			log.Printf("[%d] Character '%s' has been deleted by '%s' from %s\n",
+				player.Id,
+				character.Name,
+				player.Account.Name,
+				player.Connection.RemoteAddr())
+
+			character.Clear()
+
+			SendAlert(player, "Character has been deleted!")
+		}
+	})
 }
 
 // ::::::::::::::::::::::::::::
 // :: Using character packet ::
 // ::::::::::::::::::::::::::::
 
-func HandleSelectCharacter(player *PlayerData, reader *net.PacketReader) {
-	if !player.IsLoggedIn() || player.Character != nil {
+func HandleSelectCharacter(player *PlayerData, packet *ClSelectCharacterPacket) {
+	if !player.IsLoggedIn() || player.Character != nil || player.busy {
 		return
 	}
 
 	// Get the index of the selected character slot
-	slot := reader.ReadLong() - 1
+	slot := packet.Slot - 1
+
 	if slot < 0 || slot >= len(player.CharacterList) {
 		ReportHack(player, "character slot out of range")
+		return
 	}
 
 	// Check whether the character exists
 	if player.CharacterList[slot].Id == 0 {
 		SendAlert(player, "character does not exist")
+		return
 	}
 
 	player.Character = &player.CharacterList[slot]
@@ -315,19 +478,24 @@ const (
 	MoveRun  = 2
 )
 
-func HandlePlayerMove(player *PlayerData, reader *net.PacketReader) {
+func HandlePlayerMove(player *PlayerData, packet *ClPlayerMovePacket) {
 	if player.GettingLevel {
 		return
 	}
 
-	dir := common.Direction(reader.ReadLong())
+	dir := common.Direction(packet.Dir)
+	movement := packet.Movement
 
-	movement := reader.ReadLong()
 	if movement != MoveWalk && movement != MoveRun {
 		ReportHack(player, "invalid movement")
 		return
 	}
 
+	if dir < common.DirUp || dir > common.DirRight {
+		ReportHack(player, "invalid direction")
+		return
+	}
+
 	// Prevent player from moving if they have cast a spell
 	if player.CastSpell {
 		if utils.GetTickCount() > player.AttackTimer+1000 {
@@ -345,8 +513,12 @@ func HandlePlayerMove(player *PlayerData, reader *net.PacketReader) {
 // :: Player request for a new map ::
 // ::::::::::::::::::::::::::::::::::
 
-func HandleRequestNewLevel(player *PlayerData, reader *net.PacketReader) {
-	dir := common.Direction(reader.ReadLong())
+func HandleRequestNewLevel(player *PlayerData, packet *ClRequestNewLevelPacket) {
+	dir := common.Direction(packet.Dir)
+	if dir < common.DirUp || dir > common.DirRight {
+		ReportHack(player, "invalid direction")
+		return
+	}
 
 	MovePlayer(player, dir, MoveWalk)
 }
@@ -355,19 +527,7 @@ func HandleRequestNewLevel(player *PlayerData, reader *net.PacketReader) {
 // :: Map data packet ::
 // :::::::::::::::::::::
 
-func utf16ToString(src []byte) string {
-	codes := make([]uint16, len(src)/2)
-	for i := 0; i < len(codes); i++ {
-		codes[i] = binary.LittleEndian.Uint16(src[i*2:])
-	}
-
-	runes := utf16.Decode(codes)
-	str := string(runes)
-
-	return strings.TrimSpace(str)
-}
-
-func HandleLevelData(player *PlayerData, reader *net.PacketReader) {
+func HandleLevelData(player *PlayerData, packet *ClLevelDataPacket) {
 	if player.Room == nil || player.Character == nil {
 		return
 	}
@@ -378,39 +538,11 @@ func HandleLevelData(player *PlayerData, reader *net.PacketReader) {
 	}
 
 	levelId := player.Room.Id
-	level := player.Room.Level
-	newRevision := level.Revision + 1
-
-	level.Name = utf16ToString(reader.Read(config.NameLength * 2))
-	level.Revision = reader.ReadLong()
-	level.Type = data.LevelType(reader.ReadInteger())
-	level.TileSet = reader.ReadInteger()
-	level.Up = reader.ReadInteger() - 1
-	level.Down = reader.ReadInteger() - 1
-	level.Left = reader.ReadInteger() - 1
-	level.Right = reader.ReadInteger() - 1
-	level.Music = reader.ReadInteger()
-	level.BootMap = reader.ReadInteger() - 1
-	level.BootX = int(reader.ReadByte())
-	level.BootY = int(reader.ReadByte())
-	level.Shop = reader.ReadInteger() - 1
-
-	for i := 0; i < len(level.Tiles); i++ {
-		for j := 0; j < len(level.Tiles[i].Num); j++ {
-			level.Tiles[i].Num[j] = reader.ReadInteger()
-		}
+	newRevision := player.Room.Level.Revision + 1
 
-		level.Tiles[i].Type = data.TileType(reader.ReadInteger())
-		level.Tiles[i].Data1 = reader.ReadInteger()
-		level.Tiles[i].Data2 = reader.ReadInteger()
-		level.Tiles[i].Data3 = reader.ReadInteger()
-	}
+	setLevelInfo(player.Room.Level, &packet.Level)
 
-	for i := 0; i < config.MaxMapNpcs; i++ {
-		level.Npcs[i] = int(reader.ReadByte()) - 1
-	}
-
-	level.Revision = newRevision
+	player.Room.Level.Revision = newRevision
 
 	for i := 0; i < config.MaxMapNpcs; i++ {
 		// TODO: Call ClearMapNpc(I, MapNum)
@@ -430,10 +562,12 @@ func HandleLevelData(player *PlayerData, reader *net.PacketReader) {
 	   Call SpawnMapItems(GetPlayerMap(Index))
 	*/
 
+	// The level stays marked as modified when saving fails, so the save is retried by the next autosave
+	data.MarkDirty(data.ContentLevels, levelId-1)
 	data.SaveLevel(levelId - 1)
 
 	// Rebuild the level cache
-	player.Room.LevelCache = buildLevelCache(levelId, level)
+	player.Room.LevelCache = buildLevelCache(levelId, player.Room.Level)
 
 	// Refresh level data for all players in the room
 	for _, p := range player.Room.Players {
@@ -447,10 +581,9 @@ func HandleLevelData(player *PlayerData, reader *net.PacketReader) {
 // :: Need map yes/no packet ::
 // ::::::::::::::::::::::::::::
 
-func HandleNeedLevel(player *PlayerData, reader *net.PacketReader) {
+func HandleNeedLevel(player *PlayerData, packet *ClNeedLevelPacket) {
 	//  Check if map data is needed to be sent
-	needMap := reader.ReadByte()
-	if needMap != 0 {
+	if packet.NeedLevel {
 		SendLevelData(player)
 	}
 
@@ -462,10 +595,7 @@ func HandleNeedLevel(player *PlayerData, reader *net.PacketReader) {
 	player.GettingLevel = false
 
 	// Tell the player all map data has been sent
-	writer := net.NewWriter()
-	writer.WriteInteger(SvLevelDone)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvLevelDonePacket{})
 
 	//  Call SendDoorData(Index)
 }
@@ -474,7 +604,7 @@ func HandleNeedLevel(player *PlayerData, reader *net.PacketReader) {
 // :: Request edit map packet ::
 // :::::::::::::::::::::::::::::
 
-func HandleRequestEditLevel(player *PlayerData, reader *net.PacketReader) {
+func HandleRequestEditLevel(player *PlayerData, _ *ClRequestEditLevelPacket) {
 	if player.Character == nil {
 		return
 	}
@@ -483,8 +613,54 @@ func HandleRequestEditLevel(player *PlayerData, reader *net.PacketReader) {
 		return
 	}
 
-	writer := net.NewWriter()
-	writer.WriteInteger(SvEditLevel)
+	player.SendPacket(&SvEditLevelPacket{})
+}
+
+// ::::::::::::::::::::::::::::
+// :: Request content packet ::
+// ::::::::::::::::::::::::::::
+
+func HandleRequestContent(player *PlayerData, packet *ClRequestContentPacket) {
+	if !player.IsPlaying() || !player.Capabilities.Has(CapContentManifest) {
+		return
+	}
+
+	SendContent(player, packet)
+}
+
+// :::::::::::::::::
+// :: Pong packet ::
+// :::::::::::::::::
+
+func HandlePong(_ *PlayerData, _ *ClPongPacket) {
+	// Receiving the pong is enough to keep the connection alive
+}
+
+// :::::::::::::::::::::::::::
+// :: Reload content packet ::
+// :::::::::::::::::::::::::::
+
+func HandleReloadContent(player *PlayerData, _ *ClReloadContentPacket) {
+	if !player.IsPlaying() {
+		return
+	}
+
+	// Make sure the player has developer access
+	if player.Character.Access < character.AccessDeveloper {
+		return
+	}
 
-	player.Send(writer.Bytes())
+	log.Printf("[%d] %s requested a content reload\n", player.Id, player.Character.Name)
+
+	requestedBy := player.Character
+	started := ReloadContent(func(changes data.Changes) {
+		if player.Character != requestedBy || !player.IsPlaying() {
+			return
+		}
+		SendMessage(player, fmt.Sprintf("Reloaded %s.", describeChanges(changes)), color.AdminColor)
+	})
+
+	if !started {
+		SendMessage(player, "Content is already being reloaded.", color.AdminColor)
+	}
 }
@@ -2,8 +2,9 @@
 
 import (
 	"fmt"
+	"log"
+	"time"
 
-	"github.com/guthius/mirage-nova/net"
 	"github.com/guthius/mirage-nova/server/character"
 	"github.com/guthius/mirage-nova/server/color"
 	"github.com/guthius/mirage-nova/server/common"
@@ -298,32 +299,114 @@ func JoinGame(p *PlayerData) {
 		SendGlobalMessage(fmt.Sprintf("%s has joined %s!", char.Name, config.GameName), color.White)
 	}
 
+	CheckEquippedItems(p)
+
+	sendGameData(p)
+
+	// Warp the player to his saved location
+	rooms[char.Room].AddPlayer(p)
+
+	// Send welcome messages
+	SendWelcome(p)
+
+	// Send the flag so they know they can start doing stuff
+	SendInGame(p)
+}
+
+// ResumeGame puts a player that reconnected to their session back in game, exactly where they were.
+func ResumeGame(p *PlayerData) {
+	if p.Character == nil || p.Room == nil {
+		return
+	}
+
+	UpdateHighIndex()
+
+	sendGameData(p)
+
+	p.Room.Resync(p)
+
+	SendWelcome(p)
+	SendInGame(p)
+}
+
+// sendGameData sends all data the client needs before the player enters the game.
+func sendGameData(p *PlayerData) {
 	// Send an ok to client to start receiving in game data
 	SendLoginOk(p)
 
 	// Send some more little goodies, no need to explain these
-	CheckEquippedItems(p)
-
 	SendClasses(p)
-	SendItems(p)
-	SendNpcs(p)
-	SendShops(p)
-	SendSpells(p)
+
+	// Clients that support the content manifest request the content they are missing themselves
+	if p.Capabilities.Has(CapContentManifest) {
+		SendContentManifest(p)
+	} else {
+		SendItems(p)
+		SendNpcs(p)
+		SendShops(p)
+		SendSpells(p)
+	}
+
 	SendInventory(p)
 	SendEquipment(p)
 	SendVital(p, vitals.HP)
 	SendVital(p, vitals.MP)
 	SendVital(p, vitals.SP)
 	SendStats(p)
+}
 
-	// Warp the player to his saved location
-	rooms[char.Room].AddPlayer(p)
+// LeftGame removes the player from the game, lets everyone know they have left and saves their character.
+// The character is saved in the background; the returned channel receives the result once it has been written.
+// Failures are logged and returned by WaitForSaves as well.
+func LeftGame(p *PlayerData) <-chan error {
+	saved := make(chan error, 1)
 
-	// Send welcome messages
-	SendWelcome(p)
+	char := p.Character
+	if char == nil {
+		saved <- nil
+		return saved
+	}
 
-	// Send the flag so they know they can start doing stuff
-	SendInGame(p)
+	// The player no longer counts towards the high index once they have left
+	p.LinkDead = false
+
+	if p.Room != nil {
+		p.Room.RemovePlayer(p)
+		p.Room = nil
+	}
+
+	// Check for boot map
+	level := data.GetLevel(char.Room)
+	if level != nil && level.BootMap >= 0 && level.BootMap < config.MaxMaps {
+		char.Room = level.BootMap
+		char.X = level.BootX
+		char.Y = level.BootY
+	}
+
+	// The character is saved in the background from a copy, as the player may log in again right away
+	snapshot := *char
+	queueSave([]*character.Character{&snapshot}, func(err error, elapsed time.Duration) {
+		if err != nil {
+			err = fmt.Errorf("saving character %s: %w", snapshot.Name, err)
+			log.Println(err)
+			recordSaveError(err)
+		}
+		saved <- err
+	})
+
+	if char.Access == character.AccessNone {
+		SendGlobalMessage(fmt.Sprintf("%s has left %s!", char.Name, config.GameName), color.JoinLeftColor)
+	} else {
+		SendGlobalMessage(fmt.Sprintf("%s has left %s!", char.Name, config.GameName), color.White)
+	}
+
+	log.Printf("[%d] %s(%s) stopped playing\n", p.Id, p.Account.Name, char.Name)
+
+	PlayersOnline--
+
+	UpdateHighIndex()
+
+	return saved
 }
 
 // Public Sub LeftGame(ByVal Index As Long)
@@ -1559,6 +1642,44 @@ func MovePlayerToRoom(player *PlayerData, roomId int, dx int, dy int) {
 	room.AddPlayerAt(player, dx, dy)
 }
 
+// getAdjacentRoom returns the ID of the room next to the level in the specified direction,
+// along with the position at which a player that walks off the edge of the level at (x, y) enters it.
+func getAdjacentRoom(level *data.LevelData, dir common.Direction, x int, y int) (int, int, int) {
+	switch dir {
+	case common.DirUp:
+		if level.Up >= 0 && level.Up < config.MaxMaps {
+			return level.Up, x, rooms[level.Up].Level.Height - 1
+		}
+	case common.DirDown:
+		return level.Down, x, 0
+	case common.DirLeft:
+		if level.Left >= 0 && level.Left < config.MaxMaps {
+			return level.Left, rooms[level.Left].Level.Width - 1, y
+		}
+	case common.DirRight:
+		return level.Right, 0, y
+	}
+	return -1, x, y
+}
+
+// checkDestination returns the reason the player can not move onto the specified tile of the room,
+// or an empty string if they can. Doors that do not need a key open when a player walks into them.
+func checkDestination(player *PlayerData, room *Room, x int, y int) string {
+	if tile := room.GetTile(x, y); tile != nil && tile.Data.Type == data.TileTypeDoor {
+		room.OpenDoor(x, y)
+	}
+
+	if !room.IsWalkable(x, y) {
+		return "moving onto a blocked tile"
+	}
+
+	if room.IsOccupied(x, y, player) {
+		return "moving onto an occupied tile"
+	}
+
+	return ""
+}
+
 // MovePlayer moves the player in the specified direction.
 func MovePlayer(player *PlayerData, dir common.Direction, movement int) {
 	if player.Room == nil || player.Character == nil {
@@ -1567,38 +1688,73 @@ func MovePlayer(player *PlayerData, dir common.Direction, movement int) {
 
 	player.Character.Dir = dir
 
+	// Enforce the walk and run speeds, players may only get ahead of their speed by a small margin
+	now := utils.GetTickCount()
+	if player.MoveTimer-now > config.MoveTolerance {
+		RejectMove(player, "moving too fast")
+		return
+	}
+
+	delay := int64(config.WalkDelay)
+	if movement == MoveRun {
+		delay = config.RunDelay
+	}
+
 	dx, dy := utils.GetAdjacentTile(player.Character.X, player.Character.Y, dir)
 
 	// If the player is trying to move out of bounds move them to the adjacent room
 	if !player.Room.Level.Contains(dx, dy) {
-		switch dir {
-		case common.DirUp:
-			MovePlayerToRoom(player, player.Room.Level.Up, dx, player.Room.Level.Height-1)
-		case common.DirDown:
-			MovePlayerToRoom(player, player.Room.Level.Down, dx, 0)
-		case common.DirLeft:
-			MovePlayerToRoom(player, player.Room.Level.Left, player.Room.Level.Width-1, dy)
-		case common.DirRight:
-			MovePlayerToRoom(player, player.Room.Level.Right, 0, dy)
+		roomId, x, y := getAdjacentRoom(player.Room.Level, dir, dx, dy)
+		if roomId < 0 || roomId >= config.MaxMaps || &rooms[roomId] == player.Room {
+			RejectMove(player, "moving off the edge of the level")
+			return
+		}
+
+		room := &rooms[roomId]
+		if reason := checkDestination(player, room, x, y); reason != "" {
+			RejectMove(player, reason)
+			return
 		}
+
+		player.MoveTimer = max(player.MoveTimer, now) + delay
+
+		room.AddPlayerAt(player, x, y)
 		return
 	}
 
-	// Move the player to the new position
-	writer := net.NewWriter()
+	if reason := checkDestination(player, player.Room, dx, dy); reason != "" {
+		RejectMove(player, reason)
+		return
+	}
 
-	writer.WriteInteger(SvPlayerMove)
-	writer.WriteLong(player.Id + 1)
-	writer.WriteLong(player.Character.X)
-	writer.WriteLong(player.Character.Y)
-	writer.WriteLong(int(player.Character.Dir))
-	writer.WriteLong(movement)
+	player.MoveTimer = max(player.MoveTimer, now) + delay
+
+	// Move the player to the new position
+	player.Character.X = dx
+	player.Character.Y = dy
 
-	player.Room.SendExclude(writer.Bytes(), player)
+	player.Room.SendPacketExclude(&SvPlayerMovePacket{
+		PlayerId: player.Id + 1,
+		X:        player.Character.X,
+		Y:        player.Character.Y,
+		Dir:      int(player.Character.Dir),
+		Movement: movement,
+	}, player)
 
 	TriggerTileEffect(player)
 }
 
+// RejectMove puts the player back at the position known to the server.
+// Players whose moves are rejected repeatedly are disconnected.
+func RejectMove(player *PlayerData, reason string) {
+	SendPlayerXY(player)
+
+	// Only kick once, the moves that are still queued for the player are rejected until the connection is closed
+	if player.moveRejects.add(utils.GetTickCount(), config.MoveViolationWindow) == config.MoveViolationThreshold {
+		ReportHack(player, reason)
+	}
+}
+
 // CheckEquippedItems checks wether the type of the items equipped by the specified player match the slots in which they are equipped.
 // If the item type does not match the slot, the item is removed from that slot.
 func CheckEquippedItems(p *PlayerData) {
@@ -2106,14 +2262,10 @@ func UpdateHighIndex() {
 	index := 0
 
 	for i := 0; i < config.MaxPlayers; i++ {
-		if players[i].IsLoggedIn() {
+		if players[i].IsLoggedIn() || players[i].LinkDead {
 			index = i + 1
 		}
 	}
 
-	writer := net.NewWriter()
-	writer.WriteInteger(SvHighIndex)
-	writer.WriteLong(index)
-
-	SendDataToAll(writer.Bytes())
+	SendPacketToAll(&SvHighIndexPacket{Index: index})
 }
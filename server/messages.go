@@ -23,8 +23,16 @@ func ReportHack(p *PlayerData, reason string) {
 }
 
 func SendDataToAll(bytes []byte) {
-	for _, p := range players {
-		p.Send(bytes)
+	for i := range players {
+		players[i].Send(bytes)
+	}
+}
+
+// SendPacketToAll sends the specified packet to all connected players.
+func SendPacketToAll(packet net.Packet) {
+	cache := net.NewPacketCache(packet)
+	for i := range players {
+		players[i].SendCached(cache)
 	}
 }
 
@@ -39,13 +47,10 @@ func SendWelcome(player *PlayerData) {
 }
 
 func SendGlobalMessage(message string, color color.Color) {
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvGlobalMessage)
-	writer.WriteString(message)
-	writer.WriteByte(byte(color))
-
-	SendDataToAll(writer.Bytes())
+	SendPacketToAll(&SvGlobalMessagePacket{
+		Message: message,
+		Color:   color,
+	})
 }
 
 func SendPlayersOnline(player *PlayerData) {
@@ -74,99 +79,82 @@ func SendAlert(player *PlayerData, message string) {
 		return
 	}
 
-	writer := net.NewWriter()
+	player.SendPacket(&SvAlertPacket{Message: message})
+	player.Disconnect()
+}
 
-	writer.WriteInteger(SvAlert)
-	writer.WriteString(message)
+// SendOutdated tells the player their client must be updated and disconnects them.
+func SendOutdated(player *PlayerData) {
+	SendAlert(player, fmt.Sprintf(
+		"Your client is outdated.\n\n"+
+			"To continue, please update to the latest version.\n\n"+
+			"Download the latest version from %s.", config.GameWebsite))
+}
 
-	player.Send(writer.Bytes())
-	player.Disconnect()
+// SendPings sends a ping to all players that support heartbeats. It is called periodically from the game loop.
+func SendPings(_ int64) {
+	for i := range players {
+		if players[i].Capabilities.Has(CapHeartbeat) {
+			players[i].SendPacket(&SvPingPacket{})
+		}
+	}
 }
 
 func SendCharacters(player *PlayerData) {
-	writer := net.NewWriter()
+	var packet SvCharactersPacket
 
-	writer.WriteInteger(SvCharacters)
-
-	for _, c := range player.CharacterList {
-		writer.WriteLong(c.Sprite)
-		writer.WriteString(c.Name)
-		writer.WriteByte(byte(c.Level))
+	for i, c := range player.CharacterList {
+		packet.Characters[i] = CharacterInfo{
+			Sprite: c.Sprite,
+			Name:   c.Name,
+			Level:  c.Level,
+		}
 	}
 
-	player.Send(writer.Bytes())
+	player.SendPacket(&packet)
 }
 
 func SendLoginOk(player *PlayerData) {
-	writer := net.NewWriter()
-	writer.WriteInteger(SvLoginOk)
-	writer.WriteLong(player.Id + 1)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvLoginOkPacket{PlayerId: player.Id + 1})
 }
 
-func SendNewCharClasses(player *PlayerData) {
-	writer := net.NewWriter()
-
+// getClassInfo returns the information of all classes that is shown to players.
+func getClassInfo() []ClassInfo {
 	numberOfClasses := data.GetClassCount()
 
-	writer.WriteInteger(SvNewCharClasses)
-	writer.WriteByte(byte(numberOfClasses))
-
+	result := make([]ClassInfo, 0, numberOfClasses)
 	for i := 0; i < numberOfClasses; i++ {
 		class := data.GetClass(i)
 		if class == nil {
 			continue
 		}
 
-		writer.WriteString(class.Name)
-		writer.WriteLong(class.Sprite)
-		writer.WriteLong(class.GetMaxVital(vitals.HP, class.Stats.Strength))
-		writer.WriteLong(class.GetMaxVital(vitals.MP, class.Stats.Magic))
-		writer.WriteLong(class.GetMaxVital(vitals.SP, class.Stats.Speed))
-		writer.WriteByte(byte(class.Stats.Strength))
-		writer.WriteByte(byte(class.Stats.Defense))
-		writer.WriteByte(byte(class.Stats.Speed))
-		writer.WriteByte(byte(class.Stats.Magic))
+		result = append(result, ClassInfo{
+			Name:     class.Name,
+			Sprite:   class.Sprite,
+			MaxHP:    class.GetMaxVital(vitals.HP, class.Stats.Strength),
+			MaxMP:    class.GetMaxVital(vitals.MP, class.Stats.Magic),
+			MaxSP:    class.GetMaxVital(vitals.SP, class.Stats.Speed),
+			Strength: class.Stats.Strength,
+			Defense:  class.Stats.Defense,
+			Speed:    class.Stats.Speed,
+			Magic:    class.Stats.Magic,
+		})
 	}
 
-	player.Send(writer.Bytes())
+	return result
 }
 
-func SendClasses(player *PlayerData) {
-	writer := net.NewWriter()
-
-	numberOfClasses := data.GetClassCount()
-
-	writer.WriteInteger(SvClasses)
-	writer.WriteByte(byte(numberOfClasses))
-
-	for i := 0; i < numberOfClasses; i++ {
-		class := data.GetClass(i)
-		if class == nil {
-			continue
-		}
-
-		writer.WriteString(class.Name)
-		writer.WriteLong(class.Sprite)
-		writer.WriteLong(class.GetMaxVital(vitals.HP, class.Stats.Strength))
-		writer.WriteLong(class.GetMaxVital(vitals.MP, class.Stats.Magic))
-		writer.WriteLong(class.GetMaxVital(vitals.SP, class.Stats.Speed))
-		writer.WriteByte(byte(class.Stats.Strength))
-		writer.WriteByte(byte(class.Stats.Defense))
-		writer.WriteByte(byte(class.Stats.Speed))
-		writer.WriteByte(byte(class.Stats.Magic))
-	}
+func SendNewCharClasses(player *PlayerData) {
+	player.SendPacket(&SvNewCharClassesPacket{Classes: getClassInfo()})
+}
 
-	player.Send(writer.Bytes())
+func SendClasses(player *PlayerData) {
+	player.SendPacket(&SvClassesPacket{Classes: getClassInfo()})
 }
 
 func SendInGame(player *PlayerData) {
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvInGame)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvInGamePacket{})
 }
 
 func SendInventory(player *PlayerData) {
@@ -174,17 +162,17 @@ func SendInventory(player *PlayerData) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvPlayerInventory)
+	var packet SvPlayerInventoryPacket
 
 	for i := 0; i < config.MaxInventory; i++ {
-		writer.WriteLong(player.Character.Inv[i].Item + 1)
-		writer.WriteLong(player.Character.Inv[i].Value)
-		writer.WriteLong(player.Character.Inv[i].Dur)
+		packet.Slots[i] = InventorySlotInfo{
+			Item:  player.Character.Inv[i].Item + 1,
+			Value: player.Character.Inv[i].Value,
+			Dur:   player.Character.Inv[i].Dur,
+		}
 	}
 
-	player.Send(writer.Bytes())
+	player.SendPacket(&packet)
 }
 
 func SendEquipment(player *PlayerData) {
@@ -192,47 +180,35 @@ func SendEquipment(player *PlayerData) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvPlayerEquipment)
-	writer.WriteByte(byte(player.Character.Equipment.Weapon + 1))
-	writer.WriteByte(byte(player.Character.Equipment.Armor + 1))
-	writer.WriteByte(byte(player.Character.Equipment.Helmet + 1))
-	writer.WriteByte(byte(player.Character.Equipment.Shield + 1))
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvPlayerEquipmentPacket{
+		Weapon: player.Character.Equipment.Weapon + 1,
+		Armor:  player.Character.Equipment.Armor + 1,
+		Helmet: player.Character.Equipment.Helmet + 1,
+		Shield: player.Character.Equipment.Shield + 1,
+	})
 }
 
 func SendVital(player *PlayerData, vital vitals.Type) {
-	writer := net.NewWriter()
+	maxValue := player.GetMaxVital(vital)
+	value := player.GetVital(vital)
 
 	switch vital {
 	case vitals.HP:
-		writer.WriteInteger(SvPlayerHP)
+		player.SendPacket(&SvPlayerHPPacket{Max: maxValue, Value: value})
 	case vitals.MP:
-		writer.WriteInteger(SvPlayerMP)
+		player.SendPacket(&SvPlayerMPPacket{Max: maxValue, Value: value})
 	case vitals.SP:
-		writer.WriteInteger(SvPlayerSP)
-	default:
-		return
+		player.SendPacket(&SvPlayerSPPacket{Max: maxValue, Value: value})
 	}
-
-	writer.WriteLong(player.GetMaxVital(vital))
-	writer.WriteLong(player.GetVital(vital))
-
-	player.Send(writer.Bytes())
 }
 
 func SendStats(player *PlayerData) {
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvPlayerStats)
-	writer.WriteLong(player.Character.Stats.Strength)
-	writer.WriteLong(player.Character.Stats.Defense)
-	writer.WriteLong(player.Character.Stats.Speed)
-	writer.WriteLong(player.Character.Stats.Magic)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvPlayerStatsPacket{
+		Strength: player.Character.Stats.Strength,
+		Defense:  player.Character.Stats.Defense,
+		Speed:    player.Character.Stats.Speed,
+		Magic:    player.Character.Stats.Magic,
+	})
 }
 
 func SendPlayerXY(player *PlayerData) {
@@ -240,13 +216,10 @@ func SendPlayerXY(player *PlayerData) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvPlayerXY)
-	writer.WriteLong(player.Character.X)
-	writer.WriteLong(player.Character.Y)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvPlayerXYPacket{
+		X: player.Character.X,
+		Y: player.Character.Y,
+	})
 }
 
 func SendCheckForLevel(player *PlayerData, levelId int) {
@@ -255,30 +228,24 @@ func SendCheckForLevel(player *PlayerData, levelId int) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvCheckForLevel)
-	writer.WriteLong(levelId + 1)
-	writer.WriteLong(levelData.Revision)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvCheckForLevelPacket{
+		LevelId:  levelId + 1,
+		Revision: levelData.Revision,
+	})
 }
 
 func SendLevelData(player *PlayerData) {
 	if player.Room == nil {
 		return
 	}
-	player.Send(player.Room.LevelCache)
+	player.SendCached(player.Room.LevelCache)
 }
 
 func SendMessage(player *PlayerData, message string, color color.Color) {
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvPlayerMessage)
-	writer.WriteString(message)
-	writer.WriteByte(byte(color))
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvPlayerMessagePacket{
+		Message: message,
+		Color:   color,
+	})
 }
 
 func SendItems(player *PlayerData) {
@@ -292,44 +259,34 @@ func SendItems(player *PlayerData) {
 	}
 }
 
+func getUpdateItemPacket(itemId int, item *data.ItemData) *SvUpdateItemPacket {
+	return &SvUpdateItemPacket{
+		ItemId: itemId + 1,
+		Name:   item.Name,
+		Pic:    item.Pic,
+		Type:   int(item.Type),
+		Data1:  item.Data1,
+		Data2:  item.Data2,
+		Data3:  item.Data3,
+	}
+}
+
 func SendUpdateItem(player *PlayerData, itemId int) {
 	item := data.GetItem(itemId)
 	if item == nil {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateItem)
-	writer.WriteLong(itemId + 1)
-	writer.WriteString(item.Name)
-	writer.WriteInteger(item.Pic)
-	writer.WriteByte(byte(item.Type))
-	writer.WriteInteger(item.Data1)
-	writer.WriteInteger(item.Data2)
-	writer.WriteInteger(item.Data3)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(getUpdateItemPacket(itemId, item))
 }
 
 func SendUpdateItemToAll(itemId int) {
-	itemData := data.GetItem(itemId)
-	if itemData == nil {
+	item := data.GetItem(itemId)
+	if item == nil {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateItem)
-	writer.WriteLong(itemId + 1)
-	writer.WriteString(itemData.Name)
-	writer.WriteInteger(itemData.Pic)
-	writer.WriteByte(byte(itemData.Type))
-	writer.WriteInteger(itemData.Data1)
-	writer.WriteInteger(itemData.Data2)
-	writer.WriteInteger(itemData.Data3)
-
-	SendDataToAll(writer.Bytes())
+	SendPacketToAll(getUpdateItemPacket(itemId, item))
 }
 
 func SendNpcs(player *PlayerData) {
@@ -342,20 +299,21 @@ func SendNpcs(player *PlayerData) {
 	}
 }
 
+func getUpdateNpcPacket(npcId int, npcData *data.NpcData) *SvUpdateNpcPacket {
+	return &SvUpdateNpcPacket{
+		NpcId:  npcId + 1,
+		Name:   npcData.Name,
+		Sprite: npcData.Sprite,
+	}
+}
+
 func SendUpdateNpc(player *PlayerData, npcId int) {
 	npcData := data.GetNpc(npcId)
 	if npcData == nil {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateNpc)
-	writer.WriteLong(npcId + 1)
-	writer.WriteString(npcData.Name)
-	writer.WriteInteger(npcData.Sprite)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(getUpdateNpcPacket(npcId, npcData))
 }
 
 func SendUpdateNpcToAll(npcId int) {
@@ -364,14 +322,7 @@ func SendUpdateNpcToAll(npcId int) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateNpc)
-	writer.WriteLong(npcId + 1)
-	writer.WriteString(npcData.Name)
-	writer.WriteInteger(npcData.Sprite)
-
-	SendDataToAll(writer.Bytes())
+	SendPacketToAll(getUpdateNpcPacket(npcId, npcData))
 }
 
 func SendShops(player *PlayerData) {
@@ -385,19 +336,20 @@ func SendShops(player *PlayerData) {
 	}
 }
 
+func getUpdateShopPacket(shopId int, shop *data.ShopData) *SvUpdateShopPacket {
+	return &SvUpdateShopPacket{
+		ShopId: shopId + 1,
+		Name:   shop.Name,
+	}
+}
+
 func SendUpdateShop(player *PlayerData, shopId int) {
 	shop := data.GetShop(shopId)
 	if shop == nil {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateShop)
-	writer.WriteLong(shopId + 1)
-	writer.WriteString(shop.Name)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(getUpdateShopPacket(shopId, shop))
 }
 
 func SendUpdateShopToAll(shopId int) {
@@ -406,13 +358,7 @@ func SendUpdateShopToAll(shopId int) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateShop)
-	writer.WriteLong(shopId + 1)
-	writer.WriteString(shop.Name)
-
-	SendDataToAll(writer.Bytes())
+	SendPacketToAll(getUpdateShopPacket(shopId, shop))
 }
 
 func SendSpells(p *PlayerData) {
@@ -426,21 +372,22 @@ func SendSpells(p *PlayerData) {
 	}
 }
 
+func getUpdateSpellPacket(spellId int, spell *data.SpellData) *SvUpdateSpellPacket {
+	return &SvUpdateSpellPacket{
+		SpellId: spellId + 1,
+		Name:    spell.Name,
+		MPReq:   spell.MPReq,
+		Pic:     spell.Pic,
+	}
+}
+
 func SendUpdateSpell(player *PlayerData, spellId int) {
 	spell := data.GetSpell(spellId)
 	if spell == nil {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateSpell)
-	writer.WriteLong(spellId + 1)
-	writer.WriteString(spell.Name)
-	writer.WriteInteger(spell.MPReq)
-	writer.WriteInteger(spell.Pic)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(getUpdateSpellPacket(spellId, spell))
 }
 
 func SendUpdateSpellToAll(spellId int) {
@@ -449,15 +396,7 @@ func SendUpdateSpellToAll(spellId int) {
 		return
 	}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvUpdateSpell)
-	writer.WriteLong(spellId + 1)
-	writer.WriteString(spell.Name)
-	writer.WriteInteger(spell.MPReq)
-	writer.WriteInteger(spell.Pic)
-
-	SendDataToAll(writer.Bytes())
+	SendPacketToAll(getUpdateSpellPacket(spellId, spell))
 }
 
 func SendDoorData(player *PlayerData) {
@@ -475,43 +414,32 @@ func SendDoorData(player *PlayerData) {
 			tile := &room.TempTiles[tid]
 
 			if tile.DoorOpen {
-				writer := net.NewWriter()
-				writer.WriteInteger(SvDoor)
-				writer.WriteLong(x)
-				writer.WriteLong(y)
-
-				player.Send(writer.Bytes())
+				player.SendPacket(&SvDoorPacket{X: x, Y: y})
 			}
 		}
 	}
 }
 
 func SendLimits(player *PlayerData) {
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvLimits)
-	writer.WriteInteger(config.MaxPlayers)
-	writer.WriteInteger(config.MaxItems)
-	writer.WriteInteger(config.MaxNpcs)
-	writer.WriteInteger(config.MaxShops)
-	writer.WriteInteger(config.MaxSpells)
-	writer.WriteInteger(config.MaxMaps)
-
-	player.Send(writer.Bytes())
+	player.SendPacket(&SvLimitsPacket{
+		MaxPlayers: config.MaxPlayers,
+		MaxItems:   config.MaxItems,
+		MaxNpcs:    config.MaxNpcs,
+		MaxShops:   config.MaxShops,
+		MaxSpells:  config.MaxSpells,
+		MaxMaps:    config.MaxMaps,
+	})
 }
 
 func SendMapRevisions(player *PlayerData) {
-	writer := net.NewWriter()
+	var packet SvMapRevisionsPacket
 
-	writer.WriteInteger(SvMapRevisions)
 	for i := 0; i < config.MaxMaps; i++ {
 		levelData := data.GetLevel(i)
 		if levelData != nil {
-			writer.WriteLong(levelData.Revision)
-		} else {
-			writer.WriteLong(0)
+			packet.Revisions[i] = levelData.Revision
 		}
 	}
 
-	player.Send(writer.Bytes())
+	player.SendPacket(&packet)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+
+	"github.com/guthius/mirage-nova/net"
+)
+
+// PublishNetworkStats publishes the outbound queue counters of all open connections of the network through expvar.
+// It must only be called once.
+func PublishNetworkStats(network *net.Network) {
+	expvar.Publish("connections", expvar.Func(func() any {
+		return network.Stats()
+	}))
+}
+
+// ServeMetrics serves the metrics published through expvar over HTTP on the specified address.
+func ServeMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		err := http.ListenAndServe(address, mux)
+		if err != nil {
+			log.Printf("Unable to serve metrics on %s (%s)\n", address, err)
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	tcp "net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/guthius/mirage-nova/net"
+)
+
+func TestNetworkStatsArePublished(t *testing.T) {
+	c := connect(t)
+	defer c.conn.Close()
+
+	host, _, err := tcp.SplitHostPort(c.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection is added to the network in the background, so it may take a moment to show up
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var stats []net.ConnStats
+		if err := json.Unmarshal([]byte(expvar.Get("connections").String()), &stats); err != nil {
+			t.Fatal(err)
+		}
+
+		if slices.ContainsFunc(stats, func(s net.ConnStats) bool { return s.RemoteAddr == host }) {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the connection from %s is not in the published stats %+v", host, stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
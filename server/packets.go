@@ -0,0 +1,396 @@
+package main
+
+import (
+	"github.com/guthius/mirage-nova/server/color"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
+)
+
+// This file describes the layout of every packet exchanged with the client.
+// The packets are encoded and decoded by the net package, see net.Packet for the meaning of the field tags.
+
+// ::::::::::::::::::::
+// :: Shared layouts ::
+// ::::::::::::::::::::
+
+type CharacterInfo struct {
+	Sprite int    `packet:"long"`
+	Name   string `packet:"string"`
+	Level  int    `packet:"byte"`
+}
+
+type ClassInfo struct {
+	Name     string `packet:"string"`
+	Sprite   int    `packet:"long"`
+	MaxHP    int    `packet:"long"`
+	MaxMP    int    `packet:"long"`
+	MaxSP    int    `packet:"long"`
+	Strength int    `packet:"byte"`
+	Defense  int    `packet:"byte"`
+	Speed    int    `packet:"byte"`
+	Magic    int    `packet:"byte"`
+}
+
+type InventorySlotInfo struct {
+	Item  int `packet:"long"`
+	Value int `packet:"long"`
+	Dur   int `packet:"long"`
+}
+
+type TileInfo struct {
+	Num   [data.MaxTileLayers]int `packet:"integer"`
+	Type  data.TileType           `packet:"integer"`
+	Data1 int                     `packet:"integer"`
+	Data2 int                     `packet:"integer"`
+	Data3 int                     `packet:"integer"`
+}
+
+type LevelInfo struct {
+	Name     string         `packet:"utf16,len=32"` // The length must match config.NameLength.
+	Revision int            `packet:"long"`
+	Type     data.LevelType `packet:"integer"`
+	TileSet  int            `packet:"integer"`
+	Up       int            `packet:"integer"`
+	Down     int            `packet:"integer"`
+	Left     int            `packet:"integer"`
+	Right    int            `packet:"integer"`
+	Music    int            `packet:"integer"`
+	BootMap  int            `packet:"integer"`
+	BootX    int            `packet:"byte"`
+	BootY    int            `packet:"byte"`
+	Shop     int            `packet:"integer"`
+	Tiles    [data.MaxTiles]TileInfo
+	Npcs     [config.MaxMapNpcs]int `packet:"byte"`
+}
+
+// ::::::::::::::::::::
+// :: Server packets ::
+// ::::::::::::::::::::
+
+type SvAlertPacket struct {
+	Message string `packet:"string"`
+}
+
+type SvCharactersPacket struct {
+	Characters [config.MaxChars]CharacterInfo
+}
+
+type SvLoginOkPacket struct {
+	PlayerId int `packet:"long"`
+}
+
+type SvNewCharClassesPacket struct {
+	Classes []ClassInfo `packet:",count=byte"`
+}
+
+type SvClassesPacket struct {
+	Classes []ClassInfo `packet:",count=byte"`
+}
+
+type SvInGamePacket struct{}
+
+type SvPlayerInventoryPacket struct {
+	Slots [config.MaxInventory]InventorySlotInfo
+}
+
+type SvPlayerEquipmentPacket struct {
+	Weapon int `packet:"byte"`
+	Armor  int `packet:"byte"`
+	Helmet int `packet:"byte"`
+	Shield int `packet:"byte"`
+}
+
+type SvPlayerHPPacket struct {
+	Max   int `packet:"long"`
+	Value int `packet:"long"`
+}
+
+type SvPlayerMPPacket struct {
+	Max   int `packet:"long"`
+	Value int `packet:"long"`
+}
+
+type SvPlayerSPPacket struct {
+	Max   int `packet:"long"`
+	Value int `packet:"long"`
+}
+
+type SvPlayerStatsPacket struct {
+	Strength int `packet:"long"`
+	Defense  int `packet:"long"`
+	Speed    int `packet:"long"`
+	Magic    int `packet:"long"`
+}
+
+type SvPlayerDataPacket struct {
+	PlayerId    int    `packet:"long"`
+	Name        string `packet:"string"`
+	Sprite      int    `packet:"long"`
+	Room        int    `packet:"long"`
+	X           int    `packet:"long"`
+	Y           int    `packet:"long"`
+	Guild       string `packet:"string"`
+	GuildAccess int    `packet:"long"`
+	Dir         int    `packet:"long"`
+	Access      int    `packet:"long"`
+	PK          bool   `packet:"long"`
+}
+
+type SvPlayerMovePacket struct {
+	PlayerId int `packet:"long"`
+	X        int `packet:"long"`
+	Y        int `packet:"long"`
+	Dir      int `packet:"long"`
+	Movement int `packet:"long"`
+}
+
+type SvPlayerXYPacket struct {
+	X int `packet:"long"`
+	Y int `packet:"long"`
+}
+
+type SvCheckForLevelPacket struct {
+	LevelId  int `packet:"long"`
+	Revision int `packet:"long"`
+}
+
+type SvLevelDataPacket struct {
+	LevelId  int `packet:"long"`
+	Level    LevelInfo
+	Reserved [3]int `packet:"byte"`
+}
+
+type SvLevelDonePacket struct{}
+
+type SvGlobalMessagePacket struct {
+	Message string      `packet:"string"`
+	Color   color.Color `packet:"byte"`
+}
+
+type SvPlayerMessagePacket struct {
+	Message string      `packet:"string"`
+	Color   color.Color `packet:"byte"`
+}
+
+type SvRoomMessagePacket struct {
+	Message string      `packet:"string"`
+	Color   color.Color `packet:"byte"`
+}
+
+type SvUpdateItemPacket struct {
+	ItemId int    `packet:"long"`
+	Name   string `packet:"string"`
+	Pic    int    `packet:"integer"`
+	Type   int    `packet:"byte"`
+	Data1  int    `packet:"integer"`
+	Data2  int    `packet:"integer"`
+	Data3  int    `packet:"integer"`
+}
+
+type SvUpdateNpcPacket struct {
+	NpcId  int    `packet:"long"`
+	Name   string `packet:"string"`
+	Sprite int    `packet:"integer"`
+}
+
+type SvMapKeyPacket struct {
+	X    int  `packet:"long"`
+	Y    int  `packet:"long"`
+	Open bool `packet:"long"`
+}
+
+type SvEditLevelPacket struct{}
+
+type SvUpdateShopPacket struct {
+	ShopId int    `packet:"long"`
+	Name   string `packet:"string"`
+}
+
+type SvUpdateSpellPacket struct {
+	SpellId int    `packet:"long"`
+	Name    string `packet:"string"`
+	MPReq   int    `packet:"integer"`
+	Pic     int    `packet:"integer"`
+}
+
+type SvLeftPacket struct {
+	PlayerId int `packet:"long"`
+}
+
+type SvHighIndexPacket struct {
+	Index int `packet:"long"`
+}
+
+type SvDoorPacket struct {
+	X int `packet:"long"`
+	Y int `packet:"long"`
+}
+
+type SvLimitsPacket struct {
+	MaxPlayers int `packet:"integer"`
+	MaxItems   int `packet:"integer"`
+	MaxNpcs    int `packet:"integer"`
+	MaxShops   int `packet:"integer"`
+	MaxSpells  int `packet:"integer"`
+	MaxMaps    int `packet:"integer"`
+}
+
+type SvMapRevisionsPacket struct {
+	Revisions [config.MaxMaps]int `packet:"long"`
+}
+
+type SvHandshakePacket struct {
+	Version      int        `packet:"integer"`
+	Capabilities Capability `packet:"long"`
+}
+
+type SvContentManifestPacket struct {
+	Items  uint32 `packet:"long"`
+	Npcs   uint32 `packet:"long"`
+	Shops  uint32 `packet:"long"`
+	Spells uint32 `packet:"long"`
+}
+
+type SvItemsPacket struct {
+	Items []SvUpdateItemPacket `packet:",count=integer"`
+}
+
+type SvNpcsPacket struct {
+	Npcs []SvUpdateNpcPacket `packet:",count=integer"`
+}
+
+type SvShopsPacket struct {
+	Shops []SvUpdateShopPacket `packet:",count=integer"`
+}
+
+type SvSpellsPacket struct {
+	Spells []SvUpdateSpellPacket `packet:",count=integer"`
+}
+
+type SvPingPacket struct{}
+
+func (SvAlertPacket) PacketId() int           { return SvAlert }
+func (SvCharactersPacket) PacketId() int      { return SvCharacters }
+func (SvLoginOkPacket) PacketId() int         { return SvLoginOk }
+func (SvNewCharClassesPacket) PacketId() int  { return SvNewCharClasses }
+func (SvClassesPacket) PacketId() int         { return SvClasses }
+func (SvInGamePacket) PacketId() int          { return SvInGame }
+func (SvPlayerInventoryPacket) PacketId() int { return SvPlayerInventory }
+func (SvPlayerEquipmentPacket) PacketId() int { return SvPlayerEquipment }
+func (SvPlayerHPPacket) PacketId() int        { return SvPlayerHP }
+func (SvPlayerMPPacket) PacketId() int        { return SvPlayerMP }
+func (SvPlayerSPPacket) PacketId() int        { return SvPlayerSP }
+func (SvPlayerStatsPacket) PacketId() int     { return SvPlayerStats }
+func (SvPlayerDataPacket) PacketId() int      { return SvPlayerData }
+func (SvPlayerMovePacket) PacketId() int      { return SvPlayerMove }
+func (SvPlayerXYPacket) PacketId() int        { return SvPlayerXY }
+func (SvCheckForLevelPacket) PacketId() int   { return SvCheckForLevel }
+func (SvLevelDataPacket) PacketId() int       { return SvLevelData }
+func (SvLevelDonePacket) PacketId() int       { return SvLevelDone }
+func (SvGlobalMessagePacket) PacketId() int   { return SvGlobalMessage }
+func (SvPlayerMessagePacket) PacketId() int   { return SvPlayerMessage }
+func (SvRoomMessagePacket) PacketId() int     { return SvRoomMessage }
+func (SvUpdateItemPacket) PacketId() int      { return SvUpdateItem }
+func (SvUpdateNpcPacket) PacketId() int       { return SvUpdateNpc }
+func (SvMapKeyPacket) PacketId() int          { return SvMapKey }
+func (SvEditLevelPacket) PacketId() int       { return SvEditLevel }
+func (SvUpdateShopPacket) PacketId() int      { return SvUpdateShop }
+func (SvUpdateSpellPacket) PacketId() int     { return SvUpdateSpell }
+func (SvLeftPacket) PacketId() int            { return SvLeft }
+func (SvHighIndexPacket) PacketId() int       { return SvHighIndex }
+func (SvDoorPacket) PacketId() int            { return SvDoor }
+func (SvLimitsPacket) PacketId() int          { return SvLimits }
+func (SvMapRevisionsPacket) PacketId() int    { return SvMapRevisions }
+func (SvHandshakePacket) PacketId() int       { return SvHandshake }
+func (SvContentManifestPacket) PacketId() int { return SvContentManifest }
+func (SvItemsPacket) PacketId() int           { return SvItems }
+func (SvNpcsPacket) PacketId() int            { return SvNpcs }
+func (SvShopsPacket) PacketId() int           { return SvShops }
+func (SvSpellsPacket) PacketId() int          { return SvSpells }
+func (SvPingPacket) PacketId() int            { return SvPing }
+
+// ::::::::::::::::::::
+// :: Client packets ::
+// ::::::::::::::::::::
+
+type ClGetClassesPacket struct{}
+
+type ClCreateAccountPacket struct {
+	Name     string `packet:"string"`
+	Password string `packet:"string"`
+}
+
+type ClLoginPacket struct {
+	Name            string `packet:"string"`
+	Password        string `packet:"string"`
+	VersionMajor    int    `packet:"byte"`
+	VersionMinor    int    `packet:"byte"`
+	VersionRevision int    `packet:"byte"`
+}
+
+type ClCreateCharacterPacket struct {
+	Name   string `packet:"string"`
+	Gender int    `packet:"long"`
+	Class  int    `packet:"long"`
+	Slot   int    `packet:"long"`
+}
+
+type ClDeleteCharacterPacket struct {
+	Slot int `packet:"long"`
+}
+
+type ClSelectCharacterPacket struct {
+	Slot int `packet:"long"`
+}
+
+type ClPlayerMovePacket struct {
+	Dir      int `packet:"long"`
+	Movement int `packet:"long"`
+}
+
+type ClRequestNewLevelPacket struct {
+	Dir int `packet:"long"`
+}
+
+type ClLevelDataPacket struct {
+	Level LevelInfo
+}
+
+type ClNeedLevelPacket struct {
+	NeedLevel bool `packet:"byte"`
+}
+
+type ClRequestEditLevelPacket struct{}
+
+type ClHandshakePacket struct {
+	MinVersion   int        `packet:"integer"`
+	MaxVersion   int        `packet:"integer"`
+	Capabilities Capability `packet:"long"`
+}
+
+type ClRequestContentPacket struct {
+	Items  bool `packet:"byte"`
+	Npcs   bool `packet:"byte"`
+	Shops  bool `packet:"byte"`
+	Spells bool `packet:"byte"`
+}
+
+type ClPongPacket struct{}
+
+type ClReloadContentPacket struct{}
+
+func (ClGetClassesPacket) PacketId() int       { return ClGetClasses }
+func (ClCreateAccountPacket) PacketId() int    { return ClCreateAccount }
+func (ClLoginPacket) PacketId() int            { return ClLogin }
+func (ClCreateCharacterPacket) PacketId() int  { return ClCreateCharacter }
+func (ClDeleteCharacterPacket) PacketId() int  { return ClDeleteCharacter }
+func (ClSelectCharacterPacket) PacketId() int  { return ClSelectCharacter }
+func (ClPlayerMovePacket) PacketId() int       { return ClPlayerMove }
+func (ClRequestNewLevelPacket) PacketId() int  { return ClRequestNewLevel }
+func (ClLevelDataPacket) PacketId() int        { return ClLevelData }
+func (ClNeedLevelPacket) PacketId() int        { return ClNeedLevel }
+func (ClRequestEditLevelPacket) PacketId() int { return ClRequestEditLevel }
+func (ClHandshakePacket) PacketId() int        { return ClHandshake }
+func (ClRequestContentPacket) PacketId() int   { return ClRequestContent }
+func (ClPongPacket) PacketId() int             { return ClPong }
+func (ClReloadContentPacket) PacketId() int    { return ClReloadContent }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/guthius/mirage-nova/net"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
+)
+
+// legacyUtf16 is the conversion that was used for level names before the packet codec existed.
+func legacyUtf16(s string, maxLen int) []byte {
+	bytes := make([]byte, maxLen*2)
+
+	codes := utf16.Encode([]rune(s))
+	for i := 0; i < maxLen; i++ {
+		if i < len(codes) {
+			binary.LittleEndian.PutUint16(bytes[i*2:], codes[i])
+		} else {
+			binary.LittleEndian.PutUint16(bytes[i*2:], 0x20)
+		}
+	}
+
+	return bytes
+}
+
+// legacyLevelData is the level data packet as it was written by hand before the packet codec existed.
+func legacyLevelData(id int, l *data.LevelData) []byte {
+	writer := net.NewWriter()
+
+	writer.WriteInteger(SvLevelData)
+	writer.WriteLong(id)
+	writer.Write(legacyUtf16(l.Name, config.NameLength))
+	writer.WriteLong(l.Revision)
+	writer.WriteInteger(int(l.Type))
+	writer.WriteInteger(l.TileSet)
+	writer.WriteInteger(l.Up + 1)
+	writer.WriteInteger(l.Down + 1)
+	writer.WriteInteger(l.Left + 1)
+	writer.WriteInteger(l.Right + 1)
+	writer.WriteInteger(l.Music)
+	writer.WriteInteger(l.BootMap + 1)
+	_ = writer.WriteByte(byte(l.BootX))
+	_ = writer.WriteByte(byte(l.BootY))
+	writer.WriteInteger(l.Shop + 1)
+
+	for i := 0; i < len(l.Tiles); i++ {
+		for j := 0; j < len(l.Tiles[i].Num); j++ {
+			writer.WriteInteger(l.Tiles[i].Num[j])
+		}
+
+		writer.WriteInteger(int(l.Tiles[i].Type))
+		writer.WriteInteger(l.Tiles[i].Data1)
+		writer.WriteInteger(l.Tiles[i].Data2)
+		writer.WriteInteger(l.Tiles[i].Data3)
+	}
+
+	for i := 0; i < config.MaxMapNpcs; i++ {
+		_ = writer.WriteByte(byte(l.Npcs[i] + 1))
+	}
+
+	_ = writer.WriteByte(0)
+	_ = writer.WriteByte(0)
+	_ = writer.WriteByte(0)
+
+	return writer.Bytes()
+}
+
+// legacyUpdateItem is the item update packet as it was written by hand before the packet codec existed.
+func legacyUpdateItem(id int, item *data.ItemData) []byte {
+	writer := net.NewWriter()
+
+	writer.WriteInteger(SvUpdateItem)
+	writer.WriteLong(id + 1)
+	writer.WriteString(item.Name)
+	writer.WriteInteger(item.Pic)
+	_ = writer.WriteByte(byte(item.Type))
+	writer.WriteInteger(item.Data1)
+	writer.WriteInteger(item.Data2)
+	writer.WriteInteger(item.Data3)
+
+	return writer.Bytes()
+}
+
+func newTestLevel(name string) *data.LevelData {
+	l := &data.LevelData{
+		Name:     name,
+		Revision: 12,
+		Type:     data.LevelType(1),
+		TileSet:  3,
+		Up:       -1,
+		Down:     4,
+		Left:     0,
+		Right:    -1,
+		Music:    7,
+		BootMap:  2,
+		BootX:    10,
+		BootY:    11,
+		Shop:     -1,
+	}
+
+	for i := range l.Tiles {
+		l.Tiles[i].Num[i%data.MaxTileLayers] = i
+		l.Tiles[i].Type = data.TileType(i % 8)
+		l.Tiles[i].Data1 = i * 3
+		l.Tiles[i].Data2 = i % 5
+		l.Tiles[i].Data3 = 1
+	}
+
+	for i := range l.Npcs {
+		l.Npcs[i] = i - 1
+	}
+
+	return l
+}
+
+func TestLevelDataMatchesLegacyEncoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		level string
+	}{
+		{"ascii name", "Town of Mirage"},
+		{"empty name", ""},
+		{"unicode name", "Caverne d'été ☃"},
+		{"truncated name", "A level name that is longer than the thirty-two characters that fit"},
+	}
+
+	for _, tt := range tests {
+		l := newTestLevel(tt.level)
+
+		got := buildLevelCache(6, l).Bytes(0)
+		want := legacyLevelData(6, l)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encoded %d bytes that differ from the %d legacy bytes", tt.name, len(got), len(want))
+		}
+
+		if got := buildLevelCache(6, l).Bytes(config.ProtocolVersion); !bytes.Equal(got, want) {
+			t.Errorf("%s: encoding for protocol version %d differs from the legacy encoding", tt.name, config.ProtocolVersion)
+		}
+	}
+}
+
+func TestLevelInfoRoundTrip(t *testing.T) {
+	want := newTestLevel("Round trip")
+	want.Width = 20
+	want.Height = 15
+
+	r := net.NewReader(buildLevelCache(1, want).Bytes(0))
+	if id := r.ReadInteger(); id != SvLevelData {
+		t.Fatalf("read packet id %d, want %d", id, SvLevelData)
+	}
+
+	var packet SvLevelDataPacket
+	if err := r.ReadPacket(&packet); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &data.LevelData{Width: want.Width, Height: want.Height}
+	setLevelInfo(got, &packet.Level)
+
+	if *got != *want {
+		t.Errorf("level data changed after a round trip")
+	}
+}
+
+func TestUpdateItemMatchesLegacyEncoding(t *testing.T) {
+	tests := []data.ItemData{
+		{Name: "Sword", Pic: 12, Type: data.ItemType(1), Data1: 5, Data2: 0, Data3: 1},
+		{Name: "", Pic: 0},
+		{Name: "Épée légendaire", Pic: 65535, Type: data.ItemType(3), Data1: 300, Data2: 2, Data3: 9},
+	}
+
+	for i, item := range tests {
+		got := net.EncodePacket(getUpdateItemPacket(i, &item))
+		want := legacyUpdateItem(i, &item)
+		if !bytes.Equal(got, want) {
+			t.Errorf("item %q: encoded %v, want %v", item.Name, got, want)
+		}
+	}
+}
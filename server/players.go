@@ -1,6 +1,7 @@
 ﻿package main
 
 import (
+	"log"
 	"strings"
 
 	"github.com/guthius/mirage-nova/net"
@@ -11,10 +12,6 @@ import (
 	"github.com/guthius/mirage-nova/server/user"
 )
 
-const (
-	BufferSize = 4096
-)
-
 type TargetType int
 
 const (
@@ -26,8 +23,10 @@ const (
 type PlayerData struct {
 	Id            int
 	Connection    *net.Conn
+	Protocol      int        // The protocol version used by the client.
+	Capabilities  Capability // The optional protocol features supported by both the client and the server.
+	Handshaked    bool       // Whether the client has completed the handshake.
 	Account       *user.Account
-	Buffer        []byte
 	CharacterList [config.MaxChars]character.Character
 	Character     *character.Character
 	TargetType    TargetType
@@ -35,11 +34,28 @@ type PlayerData struct {
 	GettingLevel  bool
 	Room          *Room
 	AttackTimer   int64
+	MoveTimer     int64 // The time at which the last accepted move of the player completes.
 	CastSpell     bool
+	LinkDead      bool  // Whether the player is still in game after losing their connection.
+	LinkDeadTime  int64 // The time at which the player lost their connection.
+	disconnecting bool
+	busy          bool // Whether a request of the player is being handled in the background.
+	rateLimiter   rateLimiter
+	moveRejects   violationCounter
 }
 
 var players [config.MaxPlayers]PlayerData
 
+// connectionPlayers holds the player that is using each connection, indexed by the id of the connection.
+// Players keep their slot while they are link-dead, so the id of a player is not necessarily the id of their connection.
+var connectionPlayers [config.MaxPlayers]*PlayerData
+
+func init() {
+	for i := 0; i < config.MaxPlayers; i++ {
+		players[i].Id = i
+	}
+}
+
 // GetPlayer returns the player at the specified index.
 func GetPlayer(index int) *PlayerData {
 	if index < 0 || index >= config.MaxPlayers {
@@ -48,11 +64,40 @@ func GetPlayer(index int) *PlayerData {
 	return &players[index]
 }
 
-// GetPlayersInGame returns a slice that contains all players that are currently in game.
+// GetConnectionPlayer returns the player that is using the connection with the specified id, or nil if there is none.
+func GetConnectionPlayer(connId int) *PlayerData {
+	if connId < 0 || connId >= config.MaxPlayers {
+		return nil
+	}
+	return connectionPlayers[connId]
+}
+
+// allocatePlayer returns a player slot that is not in use.
+// When all slots are in use, the session of the player that has been link-dead the longest is ended to free up a slot.
+func allocatePlayer() *PlayerData {
+	var oldest *PlayerData
+
+	for i := 0; i < config.MaxPlayers; i++ {
+		p := &players[i]
+		if p.Connection == nil && !p.LinkDead {
+			return p
+		}
+		if p.LinkDead && (oldest == nil || p.LinkDeadTime < oldest.LinkDeadTime) {
+			oldest = p
+		}
+	}
+
+	// There is always a link-dead player when all slots are in use, as there are never more connections than slots
+	EndSession(oldest)
+
+	return oldest
+}
+
+// GetPlayersInGame returns a slice that contains all players that are currently in game, including link-dead players.
 func GetPlayersInGame() []*PlayerData {
 	result := make([]*PlayerData, 0, config.MaxPlayers)
 	for i := 0; i < config.MaxPlayers; i++ {
-		if players[i].IsPlaying() {
+		if players[i].IsInGame() {
 			result = append(result, &players[i])
 		}
 	}
@@ -62,15 +107,24 @@ func GetPlayersInGame() []*PlayerData {
 // Clear resets all fields of the player back to their default values.
 func (p *PlayerData) Clear() {
 	p.Connection = nil
+	p.Protocol = LegacyProtocolVersion
+	p.Capabilities = 0
+	p.Handshaked = false
 	p.Account = nil
-	p.Buffer = make([]byte, 0, BufferSize)
 	p.Character = nil
 	p.TargetType = TargetNone
 	p.Target = -1
 	p.GettingLevel = false
 	p.Room = nil
 	p.AttackTimer = 0
+	p.MoveTimer = 0
 	p.CastSpell = false
+	p.LinkDead = false
+	p.LinkDeadTime = 0
+	p.disconnecting = false
+	p.busy = false
+	p.rateLimiter = rateLimiter{}
+	p.moveRejects = violationCounter{}
 
 	for i := 0; i < config.MaxChars; i++ {
 		p.CharacterList[i].Clear()
@@ -83,22 +137,65 @@ func (p *PlayerData) Send(bytes []byte) {
 		return
 	}
 
+	if len(bytes) == 0 {
+		return
+	}
+
+	header := 0
+
+	// Compress large packets when the client supports it, but only if that actually makes them smaller
+	if p.Capabilities.Has(CapCompression) && len(bytes) > config.CompressionThreshold {
+		compressed := net.Compress(bytes)
+		if len(compressed) < len(bytes) {
+			bytes = compressed
+			header = net.FrameCompressed
+		}
+	}
+
+	maxSize := net.MaxLegacyFrameSize
+	if p.Capabilities.Has(CapCompression) {
+		maxSize = net.MaxFrameSize
+	}
+
 	size := len(bytes)
-	if size == 0 {
+	if size > maxSize {
+		log.Printf("[%d] Packet of %d bytes exceeds the maximum frame size\n", p.Id, size)
 		return
 	}
 
-	sizeBytes := []byte{byte(size), byte(size >> 8)}
+	header |= size
+
+	// The header and packet are sent together so message based transports deliver each packet as a single message
+	packet := make([]byte, 0, size+2)
+	packet = append(packet, byte(header), byte(header>>8))
+	packet = append(packet, bytes...)
 
-	p.Connection.Send(sizeBytes)
-	p.Connection.Send(bytes)
+	p.Connection.Send(packet)
+}
+
+// SendPacket encodes the specified packet for the protocol version of the player and sends it to the player.
+func (p *PlayerData) SendPacket(packet net.Packet) {
+	if p == nil || p.Connection == nil {
+		return
+	}
+	p.Send(net.EncodePacketVersion(packet, p.Protocol))
+}
+
+// SendCached sends the packet in the specified cache, encoded for the protocol version of the player.
+func (p *PlayerData) SendCached(cache *net.PacketCache) {
+	if p == nil || p.Connection == nil {
+		return
+	}
+	p.Send(cache.Bytes(p.Protocol))
 }
 
 // Disconnect closes the connection with the player.
+// Players that are disconnected by the server do not get the chance to reconnect to their session.
 func (p *PlayerData) Disconnect() {
 	if p == nil || p.Connection == nil {
 		return
 	}
+	p.disconnecting = true
 	p.Connection.Close()
 }
 
@@ -117,6 +214,11 @@ func (p *PlayerData) IsPlaying() bool {
 	return p.IsLoggedIn() && p.Character != nil
 }
 
+// IsInGame returns true if the player is in game, either playing or link-dead; otherwise, returns false.
+func (p *PlayerData) IsInGame() bool {
+	return p.IsPlaying() || (p.LinkDead && p.Character != nil)
+}
+
 // GetMaxVital returns the maximum value of the specified vital type.
 func (p *PlayerData) GetMaxVital(vital vitals.Type) int {
 	if p.Character == nil {
@@ -162,6 +264,7 @@ func (p *PlayerData) WarpTo(room *Room, x, y int) {
 }
 
 // IsAccountLoggedIn returns true if there is a player logged in with the specified account name; otherwise, returns false.
+// Link-dead players are not logged in, their session is resumed when they log in again, see FindSession.
 func IsAccountLoggedIn(accountName string) bool {
 	for _, p := range players {
 		if p.IsLoggedIn() && strings.EqualFold(p.Account.Name, accountName) {
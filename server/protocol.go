@@ -0,0 +1,35 @@
+package main
+
+import "github.com/guthius/mirage-nova/server/config"
+
+// LegacyProtocolVersion is the protocol version of clients that log in without sending a handshake first.
+const LegacyProtocolVersion = 1
+
+// Capability is a set of optional protocol features.
+// During the handshake the client sends the capabilities it supports,
+// and the server replies with the capabilities that both sides support.
+type Capability uint32
+
+const (
+	CapCompression     Capability = 1 << iota // The client accepts and may send frames with compressed payloads, once it has received the handshake reply.
+	CapContentManifest                        // The client receives a content manifest and requests the content it is missing in bulk.
+	CapHeartbeat                              // The client answers every ping with a pong.
+)
+
+// ServerCapabilities is the set of optional protocol features supported by the server.
+const ServerCapabilities = CapCompression | CapContentManifest | CapHeartbeat
+
+// Has returns true if all the specified capabilities are in the set.
+func (c Capability) Has(capability Capability) bool {
+	return c&capability == capability
+}
+
+// negotiateVersion returns the newest protocol version supported by both the client and the server,
+// or false if there is no such version.
+func negotiateVersion(minVersion int, maxVersion int) (int, bool) {
+	version := min(maxVersion, config.ProtocolVersion)
+	if version < max(minVersion, config.MinProtocolVersion) {
+		return 0, false
+	}
+	return version, true
+}
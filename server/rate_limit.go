@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/guthius/mirage-nova/server/config"
+)
+
+// RateLimit is the budget of a packet type, expressed as a token bucket.
+type RateLimit struct {
+	Rate  float64 // The number of packets per second that are allowed on average.
+	Burst float64 // The number of packets that are allowed in quick succession.
+}
+
+// defaultRateLimit is the budget of packets that do not have their own budget.
+var defaultRateLimit = RateLimit{Rate: 20, Burst: 40}
+
+// packetRateLimits holds the budget of each client packet type.
+// Packets that are expensive to handle, like logging in which verifies a password, have a small budget.
+var packetRateLimits = [MaxClientPacketId]RateLimit{
+	ClHandshake:        {Rate: 0.5, Burst: 2},
+	ClGetClasses:       {Rate: 1, Burst: 5},
+	ClCreateAccount:    {Rate: 0.1, Burst: 2},
+	ClLogin:            {Rate: 0.2, Burst: 3},
+	ClCreateCharacter:  {Rate: 0.2, Burst: 3},
+	ClDeleteCharacter:  {Rate: 0.2, Burst: 3},
+	ClSelectCharacter:  {Rate: 0.5, Burst: 3},
+	ClPlayerMove:       {Rate: 10, Burst: 20},
+	ClRequestNewLevel:  {Rate: 2, Burst: 5},
+	ClLevelData:        {Rate: 0.5, Burst: 2},
+	ClNeedLevel:        {Rate: 2, Burst: 5},
+	ClRequestEditLevel: {Rate: 1, Burst: 3},
+	ClRequestContent:   {Rate: 0.2, Burst: 2},
+	ClPong:             {Rate: 1, Burst: 5},
+	ClReloadContent:    {Rate: 0.1, Burst: 2},
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   int64
+}
+
+// violationCounter counts the violations of a player within a window of time.
+type violationCounter struct {
+	count int
+	since int64
+}
+
+// add records a violation and returns the number of violations within the window, which is given in seconds.
+func (v *violationCounter) add(now int64, window int64) int {
+	if now-v.since > window*1000 {
+		v.count = 0
+		v.since = now
+	}
+	v.count++
+	return v.count
+}
+
+// rateLimiter tracks the packet budgets of a single connection.
+type rateLimiter struct {
+	buckets    [MaxClientPacketId]tokenBucket
+	violations violationCounter
+}
+
+// floodKicks holds the times at which clients from each IP address were kicked for flooding.
+var floodKicks = make(map[string][]int64)
+
+// getRateLimit returns the budget of the specified packet type.
+func getRateLimit(packetId int) RateLimit {
+	limit := packetRateLimits[packetId]
+	if limit.Rate == 0 {
+		return defaultRateLimit
+	}
+	return limit
+}
+
+// allow takes a token from the bucket of the specified packet type and returns false if the bucket is empty.
+func (r *rateLimiter) allow(packetId int, now int64) bool {
+	limit := getRateLimit(packetId)
+
+	bucket := &r.buckets[packetId]
+	if bucket.last == 0 {
+		bucket.tokens = limit.Burst
+	} else {
+		elapsed := float64(now-bucket.last) / 1000
+		bucket.tokens = min(limit.Burst, bucket.tokens+elapsed*limit.Rate)
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+	return true
+}
+
+// HandleFlood is called when the player sends a packet that exceeds its budget.
+// The packet is dropped, players that keep flooding are kicked, and addresses that are kicked repeatedly are banned.
+func HandleFlood(player *PlayerData, packetId int, now int64) {
+	// Only kick once, the packets that are still queued for the player are dropped until the connection is closed
+	if player.rateLimiter.violations.add(now, config.FloodWindow) != config.FloodKickThreshold {
+		return
+	}
+
+	ipAddr := player.Connection.RemoteAddr()
+
+	ReportHack(player, fmt.Sprintf("flooding packet %d", packetId))
+
+	kicks := append(recentFloodKicks(floodKicks[ipAddr], now), now)
+
+	if len(kicks) < config.FloodBanThreshold {
+		floodKicks[ipAddr] = kicks
+		return
+	}
+
+	delete(floodKicks, ipAddr)
+
+	if BanIPFor(ipAddr, "Server", config.FloodBanDuration*time.Second) {
+		log.Printf("%s has been banned for %d seconds for flooding\n", ipAddr, config.FloodBanDuration)
+	}
+}
+
+// recentFloodKicks returns the kicks that are within the ban window. It reuses the memory of the specified slice.
+func recentFloodKicks(kicks []int64, now int64) []int64 {
+	recent := kicks[:0]
+	for _, t := range kicks {
+		if now-t <= config.FloodBanWindow*1000 {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// PruneFloodKicks forgets the kicks that are no longer within the ban window,
+// so the addresses of clients that were only kicked once are not kept forever.
+// It is called periodically from the game loop.
+func PruneFloodKicks(now int64) {
+	for ipAddr, kicks := range floodKicks {
+		kicks = recentFloodKicks(kicks, now)
+		if len(kicks) == 0 {
+			delete(floodKicks, ipAddr)
+			continue
+		}
+		floodKicks[ipAddr] = kicks
+	}
+}
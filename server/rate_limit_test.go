@@ -0,0 +1,139 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/guthius/mirage-nova/server/config"
+)
+
+func TestPruneFloodKicks(t *testing.T) {
+	const now = 10_000_000
+	const window = config.FloodBanWindow * 1000
+
+	tests := []struct {
+		name  string
+		kicks map[string][]int64
+		want  map[string][]int64
+	}{
+		{"no kicks", map[string][]int64{}, map[string][]int64{}},
+		{
+			"expired address removed",
+			map[string][]int64{"1.1.1.1": {now - window - 1}},
+			map[string][]int64{},
+		},
+		{
+			"recent kicks kept",
+			map[string][]int64{"1.1.1.1": {now - window, now - 1}},
+			map[string][]int64{"1.1.1.1": {now - window, now - 1}},
+		},
+		{
+			"expired kicks dropped",
+			map[string][]int64{
+				"1.1.1.1": {now - window - 5, now - 10},
+				"2.2.2.2": {now - 2*window, now - window - 1},
+				"3.3.3.3": {now},
+			},
+			map[string][]int64{
+				"1.1.1.1": {now - 10},
+				"3.3.3.3": {now},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		floodKicks = tt.kicks
+
+		PruneFloodKicks(now)
+
+		if !maps.EqualFunc(floodKicks, tt.want, slices.Equal) {
+			t.Errorf("%s: kicks are %v after pruning, want %v", tt.name, floodKicks, tt.want)
+		}
+	}
+
+	floodKicks = make(map[string][]int64)
+}
+
+func TestGetRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		packetId int
+		want     RateLimit
+	}{
+		{"own budget", ClLogin, packetRateLimits[ClLogin]},
+		{"default budget", CSayMsg, defaultRateLimit},
+	}
+
+	for _, tt := range tests {
+		if got := getRateLimit(tt.packetId); got != tt.want {
+			t.Errorf("%s: getRateLimit(%d) = %+v, want %+v", tt.name, tt.packetId, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	const start = 1_000_000
+
+	// ClLogin allows a burst of 3 packets and refills one token every 5 seconds
+	tests := []struct {
+		name  string
+		times []int64 // The times at which packets are sent, in milliseconds after the start.
+		want  []bool
+	}{
+		{"first packet", []int64{0}, []bool{true}},
+		{"burst", []int64{0, 0, 0}, []bool{true, true, true}},
+		{"burst exceeded", []int64{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"refilled", []int64{0, 0, 0, 0, 5000}, []bool{true, true, true, false, true}},
+		{"partially refilled", []int64{0, 0, 0, 4999}, []bool{true, true, true, false}},
+		{"refill capped at burst", []int64{0, 0, 0, 60_000, 60_000, 60_000, 60_000}, []bool{true, true, true, true, true, true, false}},
+		{"denied packets take no tokens", []int64{0, 0, 0, 1000, 2000, 3000, 5000}, []bool{true, true, true, false, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		var limiter rateLimiter
+
+		for i, at := range tt.times {
+			if got := limiter.allow(ClLogin, start+at); got != tt.want[i] {
+				t.Errorf("%s: packet %d at %dms allowed = %v, want %v", tt.name, i+1, at, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRateLimiterBucketsAreSeparate(t *testing.T) {
+	var limiter rateLimiter
+
+	for limiter.allow(ClLogin, 1000) {
+	}
+
+	if !limiter.allow(ClCreateAccount, 1000) {
+		t.Error("an empty bucket of one packet type denied a packet of another type")
+	}
+}
+
+func TestViolationCounter(t *testing.T) {
+	const start = 1_000_000
+	const window = 10
+
+	tests := []struct {
+		name  string
+		times []int64 // The times of the violations, in milliseconds after the start.
+		want  []int
+	}{
+		{"single", []int64{0}, []int{1}},
+		{"within window", []int64{0, 1000, 10_000}, []int{1, 2, 3}},
+		{"window expired", []int64{0, 1000, 10_001}, []int{1, 2, 1}},
+		{"new window", []int64{0, 10_001, 11_000, 20_001, 20_002}, []int{1, 1, 2, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		var v violationCounter
+
+		for i, at := range tt.times {
+			if got := v.add(start+at, window); got != tt.want[i] {
+				t.Errorf("%s: violation %d at %dms counted as %d, want %d", tt.name, i+1, at, got, tt.want[i])
+			}
+		}
+	}
+}
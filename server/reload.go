@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/guthius/mirage-nova/server/data"
+)
+
+// reloading is set while content is being loaded in the background, so only one reload runs at a time.
+var reloading atomic.Bool
+
+// ReloadContent loads the game content from the content store in the background and replaces the records
+// in use that changed. The changes are sent to all players in game, and the callback, if any, is invoked
+// with the changes on the game loop. It returns false if a reload is already running.
+// It must be called from the game loop.
+func ReloadContent(done func(changes data.Changes)) bool {
+	if !reloading.CompareAndSwap(false, true) {
+		return false
+	}
+
+	snapshot := data.NewSnapshot()
+
+	go func() {
+		snapshot.Load()
+
+		QueueEvent(func() {
+			defer reloading.Store(false)
+
+			changes := applyContent(snapshot)
+			if done != nil {
+				done(changes)
+			}
+		})
+	}()
+
+	return true
+}
+
+// WatchContent reloads the game content when it has changed in the content store. It is called periodically from the game loop.
+func WatchContent(now int64) {
+	ReloadContent(nil)
+}
+
+// applyContent replaces the records in use with the records in the snapshot and sends the changes to all players in game.
+func applyContent(snapshot *data.Snapshot) data.Changes {
+	changes := snapshot.Apply()
+	if changes.Count() == 0 {
+		return changes
+	}
+
+	for _, id := range changes.Items {
+		SendUpdateItemToAll(id)
+	}
+	for _, id := range changes.Npcs {
+		SendUpdateNpcToAll(id)
+	}
+	for _, id := range changes.Shops {
+		SendUpdateShopToAll(id)
+	}
+	for _, id := range changes.Spells {
+		SendUpdateSpellToAll(id)
+	}
+	for _, id := range changes.Levels {
+		rooms[id].reloadLevel()
+	}
+
+	log.Printf("Reloaded %s\n", describeChanges(changes))
+
+	return changes
+}
+
+// reloadLevel rebuilds the level cache of the room after its level has been reloaded,
+// and sends the new level to all players in the room. Doors that were open are closed.
+func (room *Room) reloadLevel() {
+	var openDoors []int
+	for i := 0; i < len(room.TempTiles); i++ {
+		if room.TempTiles[i].DoorOpen {
+			openDoors = append(openDoors, i)
+		}
+	}
+
+	room.LevelCache = buildLevelCache(room.Id, room.Level)
+	room.resetTempTiles()
+
+	for _, p := range room.Players {
+		if p.IsPlaying() {
+			SendLevelData(p)
+		}
+	}
+
+	// Players keep track of which doors are open themselves, so they must be told about the doors that were closed
+	width := room.Level.Width
+	for _, i := range openDoors {
+		room.SendPacket(&SvMapKeyPacket{
+			X:    i % width,
+			Y:    i / width,
+			Open: false,
+		})
+	}
+}
+
+// describeChanges returns a summary of the number of records that changed of each type.
+func describeChanges(changes data.Changes) string {
+	summary := fmt.Sprintf("%d items, %d npcs, %d shops, %d spells and %d levels",
+		len(changes.Items), len(changes.Npcs), len(changes.Shops), len(changes.Spells), len(changes.Levels))
+	if changes.Classes {
+		summary += " and the classes"
+	}
+	return summary
+}
@@ -5,9 +5,9 @@ import (
 
 	"github.com/guthius/mirage-nova/net"
 	"github.com/guthius/mirage-nova/server/color"
-	"github.com/guthius/mirage-nova/server/compat"
 	"github.com/guthius/mirage-nova/server/config"
 	"github.com/guthius/mirage-nova/server/data"
+	"github.com/guthius/mirage-nova/server/utils"
 )
 
 type TempTile struct {
@@ -19,7 +19,7 @@ type TempTile struct {
 type Room struct {
 	Id         int
 	Level      *data.LevelData
-	LevelCache []byte
+	LevelCache *net.PacketCache
 	TempTiles  []TempTile
 	Players    []*PlayerData
 	DoorTimer  int64
@@ -27,7 +27,8 @@ type Room struct {
 
 var rooms [config.MaxMaps]Room
 
-func init() {
+// InitRooms creates the rooms for all levels. The game content must have been loaded first.
+func InitRooms() {
 	for i := 0; i < len(rooms); i++ {
 		levelData := data.GetLevel(i)
 
@@ -53,46 +54,94 @@ func (room *Room) resetTempTiles() {
 	}
 }
 
-// buildLevelCache creates a byte array of the specified level data that can be sent to players.
-func buildLevelCache(id int, l *data.LevelData) []byte {
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvLevelData)
-	writer.WriteLong(id)
-	writer.Write(compat.StringToUtf16(l.Name, config.NameLength))
-	writer.WriteLong(l.Revision)
-	writer.WriteInteger(int(l.Type))
-	writer.WriteInteger(l.TileSet)
-	writer.WriteInteger(l.Up + 1)
-	writer.WriteInteger(l.Down + 1)
-	writer.WriteInteger(l.Left + 1)
-	writer.WriteInteger(l.Right + 1)
-	writer.WriteInteger(l.Music)
-	writer.WriteInteger(l.BootMap + 1)
-	writer.WriteByte(byte(l.BootX))
-	writer.WriteByte(byte(l.BootY))
-	writer.WriteInteger(l.Shop + 1)
+// UpdateRooms updates the state of all rooms. It is called periodically from the game loop.
+func UpdateRooms(now int64) {
+	for i := 0; i < len(rooms); i++ {
+		rooms[i].closeExpiredDoors(now)
+	}
+}
 
-	for i := 0; i < len(l.Tiles); i++ {
-		for j := 0; j < len(l.Tiles[i].Num); j++ {
-			writer.WriteInteger(l.Tiles[i].Num[j])
+// closeExpiredDoors closes all doors in the room that have been open for longer than the door open time.
+func (room *Room) closeExpiredDoors(now int64) {
+	width := room.Level.Width
+
+	for i := 0; i < len(room.TempTiles); i++ {
+		tile := &room.TempTiles[i]
+		if !tile.DoorOpen || now < tile.DoorTimer+config.DoorOpenTime {
+			continue
 		}
 
-		writer.WriteInteger(int(l.Tiles[i].Type))
-		writer.WriteInteger(l.Tiles[i].Data1)
-		writer.WriteInteger(l.Tiles[i].Data2)
-		writer.WriteInteger(l.Tiles[i].Data3)
+		tile.DoorOpen = false
+		tile.DoorTimer = 0
+
+		room.SendPacket(&SvMapKeyPacket{
+			X:    i % width,
+			Y:    i / width,
+			Open: false,
+		})
+	}
+}
+
+// buildLevelCache creates a cache of the specified level data that can be sent to players.
+func buildLevelCache(id int, l *data.LevelData) *net.PacketCache {
+	return net.NewPacketCache(&SvLevelDataPacket{
+		LevelId: id,
+		Level:   getLevelInfo(l),
+	})
+}
+
+// getLevelInfo converts the specified level data to the layout that is sent to players.
+func getLevelInfo(l *data.LevelData) LevelInfo {
+	info := LevelInfo{
+		Name:     l.Name,
+		Revision: l.Revision,
+		Type:     l.Type,
+		TileSet:  l.TileSet,
+		Up:       l.Up + 1,
+		Down:     l.Down + 1,
+		Left:     l.Left + 1,
+		Right:    l.Right + 1,
+		Music:    l.Music,
+		BootMap:  l.BootMap + 1,
+		BootX:    l.BootX,
+		BootY:    l.BootY,
+		Shop:     l.Shop + 1,
+	}
+
+	for i := 0; i < len(l.Tiles); i++ {
+		info.Tiles[i] = TileInfo(l.Tiles[i])
 	}
 
 	for i := 0; i < config.MaxMapNpcs; i++ {
-		writer.WriteByte(byte(l.Npcs[i] + 1))
+		info.Npcs[i] = l.Npcs[i] + 1
 	}
 
-	writer.WriteByte(0)
-	writer.WriteByte(0)
-	writer.WriteByte(0)
+	return info
+}
+
+// setLevelInfo copies the fields of the specified level layout, as sent by players, to the level data.
+func setLevelInfo(l *data.LevelData, info *LevelInfo) {
+	l.Name = info.Name
+	l.Revision = info.Revision
+	l.Type = info.Type
+	l.TileSet = info.TileSet
+	l.Up = info.Up - 1
+	l.Down = info.Down - 1
+	l.Left = info.Left - 1
+	l.Right = info.Right - 1
+	l.Music = info.Music
+	l.BootMap = info.BootMap - 1
+	l.BootX = info.BootX
+	l.BootY = info.BootY
+	l.Shop = info.Shop - 1
 
-	return writer.Bytes()
+	for i := 0; i < len(l.Tiles); i++ {
+		l.Tiles[i] = data.Tile(info.Tiles[i])
+	}
+
+	for i := 0; i < config.MaxMapNpcs; i++ {
+		l.Npcs[i] = info.Npcs[i] - 1
+	}
 }
 
 // Send a packet with the specified bytes to all players on the level.
@@ -112,23 +161,59 @@ func (room *Room) SendExclude(bytes []byte, exclude *PlayerData) {
 	}
 }
 
-// SendMessage sends a message to all players in the room.
-func (room *Room) SendMessage(message string, color color.Color) {
-	writer := net.NewWriter()
+// SendPacket sends the specified packet to all players on the level.
+func (room *Room) SendPacket(packet net.Packet) {
+	room.SendPacketExclude(packet, nil)
+}
 
-	writer.WriteInteger(SvRoomMessage)
-	writer.WriteString(message)
-	writer.WriteByte(byte(color))
+// SendPacketExclude sends the specified packet to all players on the level except the specified player.
+func (room *Room) SendPacketExclude(packet net.Packet, exclude *PlayerData) {
+	cache := net.NewPacketCache(packet)
+	for _, p := range room.Players {
+		if p == exclude {
+			continue
+		}
+		p.SendCached(cache)
+	}
+}
 
-	room.Send(writer.Bytes())
+// SendMessage sends a message to all players in the room.
+func (room *Room) SendMessage(message string, color color.Color) {
+	room.SendPacket(&SvRoomMessagePacket{
+		Message: message,
+		Color:   color,
+	})
 }
 
 // SendPlayerData sends the player data of the specified player to all players in the room.
 func (room *Room) SendPlayerData(player *PlayerData) {
 	playerData := getPlayerDataPacket(player)
+	if playerData == nil {
+		return
+	}
+
+	room.SendPacket(playerData)
+}
+
+// Resync sends the state of the room to a player that is already in it, for example after reconnecting.
+func (room *Room) Resync(player *PlayerData) {
 	for _, p := range room.Players {
-		p.Send(playerData)
+		if p == player {
+			continue
+		}
+
+		playerData := getPlayerDataPacket(p)
+		if playerData != nil {
+			player.SendPacket(playerData)
+		}
 	}
+
+	player.GettingLevel = true
+
+	room.SendPlayerData(player)
+
+	SendDoorData(player)
+	SendCheckForLevel(player, room.Id)
 }
 
 // Contains returns true if the specified player is in the level; otherwise, returns false.
@@ -176,7 +261,9 @@ func (room *Room) AddPlayer(player *PlayerData) {
 	// Send the player data of all players in the room to the new player
 	for _, p := range room.Players {
 		playerData := getPlayerDataPacket(p)
-		player.Send(playerData)
+		if playerData != nil {
+			player.SendPacket(playerData)
+		}
 	}
 
 	room.Players = append(room.Players, player)
@@ -222,43 +309,80 @@ func (room *Room) RemovePlayer(player *PlayerData) {
 		}
 	}
 
-	writer := net.NewWriter()
-	writer.WriteInteger(SvLeft)
-	writer.WriteLong(player.Id + 1)
-
 	// Notify the remaining players that the specified player has left
-	for _, p := range room.Players {
-		p.Send(writer.Bytes())
-	}
+	room.SendPacket(&SvLeftPacket{PlayerId: player.Id + 1})
 }
 
-func getPlayerDataPacket(player *PlayerData) []byte {
+func getPlayerDataPacket(player *PlayerData) *SvPlayerDataPacket {
 	char := player.Character
 	if char == nil {
-		return []byte{}
+		return nil
 	}
 
-	pk := 0
-	if char.PK {
-		pk = 1
+	return &SvPlayerDataPacket{
+		PlayerId:    player.Id + 1,
+		Name:        char.Name,
+		Sprite:      char.Sprite,
+		Room:        char.Room + 1,
+		X:           char.X,
+		Y:           char.Y,
+		Guild:       char.Guild,
+		GuildAccess: char.GuildAccess,
+		Dir:         int(char.Dir),
+		Access:      int(char.Access),
+		PK:          char.PK,
 	}
+}
 
-	writer := net.NewWriter()
-
-	writer.WriteInteger(SvPlayerData)
-	writer.WriteLong(player.Id + 1)
-	writer.WriteString(char.Name)
-	writer.WriteLong(char.Sprite)
-	writer.WriteLong(char.Room + 1)
-	writer.WriteLong(char.X)
-	writer.WriteLong(char.Y)
-	writer.WriteString(char.Guild)
-	writer.WriteLong(char.GuildAccess)
-	writer.WriteLong(int(char.Dir))
-	writer.WriteLong(int(char.Access))
-	writer.WriteLong(pk)
-
-	return writer.Bytes()
+// OpenDoor opens the door at the specified position until the door open time has elapsed,
+// and tells the players in the room. It returns false if there is no closed door at the position.
+func (room *Room) OpenDoor(x int, y int) bool {
+	tile := room.GetTile(x, y)
+	if tile == nil || tile.DoorOpen {
+		return false
+	}
+
+	tile.DoorOpen = true
+	tile.DoorTimer = utils.GetTickCount()
+
+	room.SendPacket(&SvMapKeyPacket{
+		X:    x,
+		Y:    y,
+		Open: true,
+	})
+
+	return true
+}
+
+// IsWalkable returns true if players can walk onto the tile at the specified position.
+// Blocked tiles can never be walked on, and doors only while they are open.
+func (room *Room) IsWalkable(x int, y int) bool {
+	tile := room.GetTile(x, y)
+	if tile == nil {
+		return false
+	}
+
+	switch tile.Data.Type {
+	case data.TileTypeBlocked:
+		return false
+	case data.TileTypeDoor, data.TileTypeKey:
+		return tile.DoorOpen
+	}
+
+	return true
+}
+
+// IsOccupied returns true if a player other than the specified player is standing at the specified position.
+func (room *Room) IsOccupied(x int, y int, exclude *PlayerData) bool {
+	for _, p := range room.Players {
+		if p == exclude || p.Character == nil {
+			continue
+		}
+		if p.Character.X == x && p.Character.Y == y {
+			return true
+		}
+	}
+	return false
 }
 
 // GetTile returns the tile at the specified position.
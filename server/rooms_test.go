@@ -0,0 +1,185 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/guthius/mirage-nova/server/character"
+	"github.com/guthius/mirage-nova/server/common"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
+)
+
+// newTestRoom returns a room for a 4x1 level with a blocked tile, a door, a key door and a plain tile, in that order.
+func newTestRoom() *Room {
+	level := &data.LevelData{Width: 4, Height: 1}
+	level.Tiles[0].Type = data.TileTypeBlocked
+	level.Tiles[1].Type = data.TileTypeDoor
+	level.Tiles[2].Type = data.TileTypeKey
+	level.Tiles[3].Type = data.TileTypeWalkable
+
+	room := &Room{
+		Level:     level,
+		TempTiles: make([]TempTile, len(level.Tiles)),
+	}
+	room.resetTempTiles()
+
+	return room
+}
+
+func TestIsWalkable(t *testing.T) {
+	tests := []struct {
+		name string
+		x    int
+		open bool
+		want bool
+	}{
+		{"blocked", 0, false, false},
+		{"blocked while open", 0, true, false},
+		{"closed door", 1, false, false},
+		{"open door", 1, true, true},
+		{"closed key door", 2, false, false},
+		{"open key door", 2, true, true},
+		{"walkable", 3, false, true},
+		{"outside of the level", 4, false, false},
+	}
+
+	for _, tt := range tests {
+		room := newTestRoom()
+		if tt.open && !room.OpenDoor(tt.x, 0) {
+			t.Errorf("%s: the tile could not be opened", tt.name)
+		}
+
+		if got := room.IsWalkable(tt.x, 0); got != tt.want {
+			t.Errorf("%s: IsWalkable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDoorsCloseAfterOpenTime(t *testing.T) {
+	room := newTestRoom()
+
+	if !room.OpenDoor(1, 0) {
+		t.Fatal("the door could not be opened")
+	}
+	if room.OpenDoor(1, 0) {
+		t.Errorf("a door that is already open was opened again")
+	}
+	if room.OpenDoor(5, 0) {
+		t.Errorf("a door outside of the level was opened")
+	}
+
+	openedAt := room.GetTile(1, 0).DoorTimer
+
+	room.closeExpiredDoors(openedAt + config.DoorOpenTime - 1)
+	if !room.IsWalkable(1, 0) {
+		t.Errorf("the door closed before the door open time elapsed")
+	}
+
+	room.closeExpiredDoors(openedAt + config.DoorOpenTime)
+	if room.IsWalkable(1, 0) {
+		t.Errorf("the door is still open after the door open time elapsed")
+	}
+}
+
+func TestReloadLevelClosesDoors(t *testing.T) {
+	room := newTestRoom()
+	room.OpenDoor(1, 0)
+	room.OpenDoor(2, 0)
+
+	room.reloadLevel()
+
+	for x := 1; x <= 2; x++ {
+		if tile := room.GetTile(x, 0); tile.DoorOpen || tile.DoorTimer != 0 {
+			t.Errorf("the door at (%d, 0) is still open after reloading the level", x)
+		}
+	}
+}
+
+// useTestRooms replaces the first rooms with rooms for walkable levels of the specified sizes,
+// until the returned function is called. Both must be called from the game loop.
+func useTestRooms(sizes ...[2]int) (restore func()) {
+	saved := make([]Room, len(sizes))
+	copy(saved, rooms[:len(sizes)])
+
+	for i, size := range sizes {
+		level := &data.LevelData{Width: size[0], Height: size[1], Up: -1, Down: -1, Left: -1, Right: -1, Shop: -1, BootMap: -1}
+		rooms[i] = Room{
+			Id:        i + 1,
+			Level:     level,
+			TempTiles: make([]TempTile, len(level.Tiles)),
+		}
+		rooms[i].resetTempTiles()
+	}
+
+	return func() { copy(rooms[:], saved) }
+}
+
+func TestMoveIntoAdjacentRoom(t *testing.T) {
+	tests := []struct {
+		name     string
+		x        int
+		dir      common.Direction
+		setup    func(other *PlayerData)
+		wantRoom int
+		wantX    int
+		wantY    int
+	}{
+		{"edge without neighbour", 0, common.DirLeft, nil, 0, 0, 0},
+		{"into neighbour", 3, common.DirRight, nil, 1, 0, 0},
+		{"into neighbour of another size", 1, common.DirUp, nil, 1, 1, 2},
+		{"outside of smaller neighbour", 3, common.DirUp, nil, 0, 3, 0},
+		{
+			"onto blocked tile",
+			3,
+			common.DirRight,
+			func(*PlayerData) { rooms[1].Level.Tiles[0].Type = data.TileTypeBlocked },
+			0, 3, 0,
+		},
+		{
+			"onto closed door",
+			3,
+			common.DirRight,
+			func(*PlayerData) { rooms[1].Level.Tiles[0].Type = data.TileTypeDoor },
+			1, 0, 0,
+		},
+		{
+			"onto other player",
+			3,
+			common.DirRight,
+			func(other *PlayerData) { rooms[1].AddPlayerAt(other, 0, 0) },
+			0, 3, 0,
+		},
+	}
+
+	for _, tt := range tests {
+		runOnGameLoop(func() {
+			// Room 0 is a 4x1 level with room 1, a 2x3 level, above and to the right of it
+			restore := useTestRooms([2]int{4, 1}, [2]int{2, 3})
+			defer restore()
+
+			rooms[0].Level.Up = 1
+			rooms[0].Level.Right = 1
+
+			player := &PlayerData{Id: -1, Character: character.NewCharacter(0, "Mover", character.GenderMale, 0)}
+			other := &PlayerData{Id: -2, Character: character.NewCharacter(0, "Other", character.GenderMale, 0)}
+			rooms[0].AddPlayerAt(player, tt.x, 0)
+
+			if tt.setup != nil {
+				tt.setup(other)
+			}
+
+			MovePlayer(player, tt.dir, MoveWalk)
+
+			if player.Room != &rooms[tt.wantRoom] || player.Character.X != tt.wantX || player.Character.Y != tt.wantY {
+				t.Errorf("%s: player is in room %d at (%d, %d), want room %d at (%d, %d)",
+					tt.name, player.Room.Id-1, player.Character.X, player.Character.Y, tt.wantRoom, tt.wantX, tt.wantY)
+			}
+
+			// Rejected moves put the player back at their position on the server
+			rejected := tt.wantRoom == 0
+			if got := player.moveRejects.count == 1; got != rejected {
+				t.Errorf("%s: move rejected = %v, want %v", tt.name, got, rejected)
+			}
+		})
+	}
+}
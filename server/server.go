@@ -6,10 +6,12 @@ import (
 	"io"
 	"log"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/guthius/mirage-nova/net"
 	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
 
 	_ "github.com/guthius/mirage-nova/server/internal/logger"
 )
@@ -18,12 +20,18 @@ var IsShuttingDown = false
 var Motd = ""
 var PlayersOnline = 0
 
+// receiveBuffers holds the partially received packet data of each connection.
+// A buffer is only ever accessed by the receive goroutine of the connection that currently owns the id.
+var receiveBuffers [config.MaxPlayers][]byte
+
 func HandleClientConnected(id int, conn *net.Conn) {
 	log.Printf("[%d] Client connected from %s\n", id, conn.RemoteAddr())
 
-	player := GetPlayer(id)
+	player := allocatePlayer()
 	player.Connection = conn
-	player.Id = id
+	player.Protocol = LegacyProtocolVersion
+
+	connectionPlayers[id] = player
 
 	if IsBanned(conn.RemoteAddr()) {
 		SendAlert(player, fmt.Sprintf("You have been banned from %s, and you are no longer able to play.", config.GameName))
@@ -33,50 +41,100 @@ func HandleClientConnected(id int, conn *net.Conn) {
 func HandleClientDisconnected(id int, conn *net.Conn) {
 	log.Printf("[%d] Connection with %s has been terminated\n", id, conn.RemoteAddr())
 
-	player := GetPlayer(id)
-	if player.IsPlaying() {
-		// TODO: Call LeftGame
+	player := GetConnectionPlayer(id)
+	if player == nil || player.Connection != conn {
+		return
 	}
 
-	player.Clear()
+	connectionPlayers[id] = nil
+
+	// Keep players that lost their connection in game for a while, so they can reconnect to their session
+	if player.Character != nil && !player.disconnecting && !IsShuttingDown && config.ReconnectGracePeriod > 0 {
+		SetLinkDead(player)
+		return
+	}
+
+	EndSession(player)
 }
 
-func HandleDataReceived(id int, _ *net.Conn, bytes []byte) {
+// HandleDataReceived splits the received bytes into packets and queues them for processing on the game loop.
+// It is called from the receive goroutine of the connection.
+func HandleDataReceived(id int, conn *net.Conn, bytes []byte) {
 	const headerSize = 2
 
-	player := GetPlayer(id)
-
-	player.Buffer = append(player.Buffer, bytes...)
-	if len(player.Buffer) < headerSize {
+	receiveBuffers[id] = append(receiveBuffers[id], bytes...)
+	if len(receiveBuffers[id]) < headerSize {
 		return
 	}
 
-	buf := player.Buffer
+	buf := receiveBuffers[id]
 	off := 0
 
-	// Handle all packets in the buffer
+	// Queue all complete packets in the buffer
 	for len(buf) >= headerSize {
-		size := int(binary.LittleEndian.Uint16(buf))
+		header := int(binary.LittleEndian.Uint16(buf))
+		size, compressed := net.ParseFrameHeader(header, conn.Compression())
 		if len(buf) < size+headerSize {
-			return
+			break
 		}
 		off += headerSize
 		buf = buf[headerSize:]
 
-		reader := net.NewReader(buf[:size])
-		HandlePacket(player, reader)
+		// The packet is copied because the buffer is reused for the next packets
+		payload, err := readPayload(buf[:size], compressed)
+		if err != nil {
+			queued := QueueCommand(func() {
+				player := GetConnectionPlayer(id)
+				if player != nil && player.Connection == conn {
+					ReportHack(player, fmt.Sprintf("invalid compressed packet (%s)", err))
+				}
+			})
+			if !queued {
+				conn.Close()
+			}
+
+			// Nothing after an invalid packet can be trusted
+			receiveBuffers[id] = receiveBuffers[id][:0]
+			return
+		}
+
+		reader := net.NewReader(payload)
+		reader.SetMaxStringLength(config.MaxStringLength)
+		queued := QueueCommand(func() {
+			player := GetConnectionPlayer(id)
+			if player == nil || player.Connection != conn {
+				return
+			}
+			HandlePacket(player, reader)
+		})
+
+		// Disconnect clients whose packets can not be handled, rather than silently losing some of them
+		if !queued {
+			log.Printf("[%d] Disconnecting %s, the command queue is full\n", id, conn.RemoteAddr())
+			receiveBuffers[id] = receiveBuffers[id][:0]
+			conn.Close()
+			return
+		}
 
 		off += size
 		buf = buf[size:]
 	}
 
 	// Move the bytes that are remaining to the front of the buffer
-	bytesLeft := len(player.Buffer) - off
+	bytesLeft := len(receiveBuffers[id]) - off
 	if bytesLeft > 0 {
-		copy(player.Buffer, player.Buffer[off:])
+		copy(receiveBuffers[id], receiveBuffers[id][off:])
 	}
 
-	player.Buffer = player.Buffer[:bytesLeft]
+	receiveBuffers[id] = receiveBuffers[id][:bytesLeft]
+}
+
+// readPayload returns a copy of the payload of a frame, decompressing it if it is compressed.
+func readPayload(payload []byte, compressed bool) ([]byte, error) {
+	if compressed {
+		return net.Decompress(payload, config.MaxPacketSize)
+	}
+	return slices.Clone(payload), nil
 }
 
 func LoadMotd() {
@@ -99,23 +157,137 @@ func LoadMotd() {
 	Motd = string(bytes)
 }
 
-func main() {
+// createTransport creates the transport the game listens on, which is TCP optionally secured with TLS.
+func createTransport() net.Transport {
+	tcpTransport := net.TCPTransport{KeepAlive: config.KeepAlive * time.Second}
+	if !config.TLSEnabled {
+		return tcpTransport
+	}
+
+	tlsConfig, err := net.LoadTLSConfig(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return net.TLSTransport{
+		Transport: tcpTransport,
+		Config:    tlsConfig,
+		Required:  config.TLSRequired,
+	}
+}
+
+// newNetworkConfig returns the configuration of the network the game is served on,
+// which passes all connection events and received data on to the game loop.
+func newNetworkConfig(address string, transport net.Transport) net.Config {
 	networkConfig := net.Config{
-		Address:              config.GameAddr,
-		MaxConnections:       config.MaxPlayers,
-		OnClientConnected:    HandleClientConnected,
-		OnClientDisconnected: HandleClientDisconnected,
-		OnDataReceived:       HandleDataReceived,
+		Address:             address,
+		Transport:           transport,
+		MaxConnections:      config.MaxPlayers,
+		MaxConnectionsPerIP: config.MaxConnectionsPerIP,
+		IdleTimeout:         config.IdleTimeout * time.Second,
+		LoginTimeout:        config.LoginTimeout * time.Second,
+		SendQueueSize:       config.SendQueueSize,
+		MaxQueuedBytes:      config.MaxQueuedBytes,
+		OnClientConnected: func(id int, conn *net.Conn) {
+			QueueEvent(func() { HandleClientConnected(id, conn) })
+		},
+		OnClientDisconnected: func(id int, conn *net.Conn) {
+			// The receive goroutine of the connection has stopped, so the buffer can safely be reset
+			receiveBuffers[id] = receiveBuffers[id][:0]
+
+			QueueEvent(func() { HandleClientDisconnected(id, conn) })
+		},
+		OnDataReceived: HandleDataReceived,
+	}
+
+	if config.DropSlowClientPackets {
+		networkConfig.SlowClientPolicy = net.DropPackets
+	}
+
+	return networkConfig
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		os.Exit(RunCommand(os.Args[1:]))
 	}
 
+	transport := createTransport()
+
+	networkConfig := newNetworkConfig(config.GameAddr, transport)
+
 	LoadMotd()
 
-	err := net.Start(networkConfig)
+	err := data.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	InitRooms()
+
+	if config.ValidateContent {
+		err := validateContent()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = OpenStores()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	AddTimer(time.Second/config.TickRate, UpdateRooms)
+	AddTimer(time.Second, UpdateShutdown)
+	AddTimer(time.Second, UpdateSessions)
+	AddTimer(config.HeartbeatRate*time.Second, SendPings)
+	AddTimer(config.FloodBanWindow*time.Second, PruneFloodKicks)
+
+	if config.AutosaveInterval > 0 {
+		AddTimer(config.AutosaveInterval*time.Second, Autosave)
+	}
+
+	if config.ContentWatchInterval > 0 {
+		AddTimer(config.ContentWatchInterval*time.Second, WatchContent)
+	}
+
+	network, err := net.Start(networkConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	for {
-		time.Sleep(1 * time.Second)
+	if config.WebAddr != "" {
+		err = network.Listen(net.WebSocketTransport{
+			Transport:   transport,
+			CheckOrigin: net.AllowOrigins(config.WebOrigins...),
+		}, config.WebAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if config.MetricsAddr != "" {
+		PublishNetworkStats(network)
+		ServeMetrics(config.MetricsAddr)
 	}
+
+	HandleShutdownSignals(network)
+
+	RunGameLoop()
+
+	// Characters are saved in the background, so the saves must be finished before the databases are closed
+	err = WaitForSaves()
+	if err != nil {
+		log.Printf("Not all characters could be saved (%s)\n", err)
+	} else {
+		log.Println("All characters have been saved")
+	}
+
+	if !network.Shutdown(config.ShutdownDrainTime * time.Second) {
+		log.Println("Not all pending data could be sent to clients before shutting down")
+	}
+
+	CloseStores()
+
+	log.Println("Server has shut down")
 }
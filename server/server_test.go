@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	tcp "net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/guthius/mirage-nova/net"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
+	"github.com/guthius/mirage-nova/server/user"
+)
+
+const testAddress = "game"
+
+// testTransport is the transport of the server that is started by TestMain.
+var testTransport *net.MemoryTransport
+
+const testClasses = `[{"Name": "Warrior", "Sprite": 9, "Stats": {"Strength": 5, "Defense": 3, "Speed": 2, "Magic": 0}}]`
+
+// TestMain runs the server on a memory transport in a temporary directory, so the tests can connect to it as clients.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "mirage-nova-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := runTestServer(dir, m)
+
+	_ = os.RemoveAll(dir)
+
+	os.Exit(code)
+}
+
+func runTestServer(dir string, m *testing.M) int {
+	err := os.MkdirAll(filepath.Join(dir, "data"), 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "data", "classes.json"), []byte(testClasses), 0644)
+	}
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err == nil {
+		err = data.Load()
+	}
+	if err == nil {
+		err = OpenStores()
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	defer CloseStores()
+
+	InitRooms()
+
+	// Logging in many clients at the default cost is slow enough to time out with the race detector enabled
+	user.PasswordCost = bcrypt.MinCost
+
+	testTransport = net.NewMemoryTransport()
+
+	network, err := net.Start(newNetworkConfig(testAddress, testTransport))
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	PublishNetworkStats(network)
+
+	stopped := make(chan struct{})
+	go func() {
+		RunGameLoop()
+		close(stopped)
+	}()
+
+	code := m.Run()
+
+	QueueEvent(StopGameLoop)
+	<-stopped
+
+	_ = WaitForSaves()
+
+	network.Shutdown(time.Second)
+
+	return code
+}
+
+// testClient is a client connected to the test server.
+type testClient struct {
+	t       *testing.T
+	conn    tcp.Conn
+	packets chan []byte
+}
+
+// connect connects a new client to the test server.
+func connect(t *testing.T) *testClient {
+	t.Helper()
+
+	conn, err := testTransport.Dial(testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testClient{t: t, conn: conn, packets: make(chan []byte, 64)}
+
+	// The memory transport is synchronous, so packets must be read as soon as the server sends them
+	go func() {
+		defer close(c.packets)
+
+		header := make([]byte, 2)
+		for {
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+
+			packet := make([]byte, binary.LittleEndian.Uint16(header))
+			if _, err := io.ReadFull(conn, packet); err != nil {
+				return
+			}
+
+			c.packets <- packet
+		}
+	}()
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return c
+}
+
+func (c *testClient) send(p net.Packet) {
+	c.t.Helper()
+
+	packet := net.EncodePacket(p)
+
+	frame := binary.LittleEndian.AppendUint16(nil, uint16(len(packet)))
+	if _, err := c.conn.Write(append(frame, packet...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive waits for a packet with the specified id, skipping all other packets, and reads it into p.
+func (c *testClient) receive(p net.Packet) {
+	c.t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case packet, ok := <-c.packets:
+			if !ok {
+				c.t.Fatalf("disconnected while waiting for packet %d", p.PacketId())
+			}
+
+			r := net.NewReader(packet)
+			if r.ReadInteger() != p.PacketId() {
+				continue
+			}
+			if err := r.ReadPacket(p); err != nil {
+				c.t.Fatal(err)
+			}
+			return
+
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for packet %d", p.PacketId())
+		}
+	}
+}
+
+// expectAlert waits for an alert with the specified message, after which the server closes the connection.
+func (c *testClient) expectAlert(message string) {
+	c.t.Helper()
+
+	var alert SvAlertPacket
+	c.receive(&alert)
+	if alert.Message != message {
+		c.t.Fatalf("received alert %q, want %q", alert.Message, message)
+	}
+
+	c.expectDisconnect()
+}
+
+func (c *testClient) expectDisconnect() {
+	c.t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-c.packets:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for the server to disconnect")
+		}
+	}
+}
+
+func newLoginPacket(name string, password string) *ClLoginPacket {
+	return &ClLoginPacket{
+		Name:            name,
+		Password:        password,
+		VersionMajor:    config.VersionMajor,
+		VersionMinor:    config.VersionMinor,
+		VersionRevision: config.VersionRevision,
+	}
+}
+
+var nameCount int
+
+// uniqueName returns a name that has not been used by any test yet, so tests can be run more than once against the same server.
+func uniqueName(prefix string) string {
+	nameCount++
+	return fmt.Sprintf("%s%d", prefix, nameCount)
+}
+
+func createAccount(t *testing.T, name string, password string) {
+	t.Helper()
+
+	c := connect(t)
+	c.send(&ClCreateAccountPacket{Name: name, Password: password})
+	c.expectAlert("Your account has been created!")
+}
+
+func login(t *testing.T, name string, password string) (*testClient, *SvCharactersPacket) {
+	t.Helper()
+
+	c := connect(t)
+	c.send(newLoginPacket(name, password))
+
+	var characters SvCharactersPacket
+	c.receive(&characters)
+
+	return c, &characters
+}
+
+func TestCreateAccount(t *testing.T) {
+	name := uniqueName("Create")
+	createAccount(t, name, "secret")
+
+	tests := []struct {
+		name     string
+		password string
+		alert    string
+	}{
+		{name, "other", "Sorry, that account name is already taken!"},
+		{"ab", "secret", "Your account name must be between 3 and 20 characters long."},
+		{"NoPassword", "ab", "Your password must be between at least 3 characters long."},
+		{"Bad!Name", "secret", "Invalid account name, only letters, numbers, spaces, and _ allowed in names."},
+	}
+
+	for _, tt := range tests {
+		c := connect(t)
+		c.send(&ClCreateAccountPacket{Name: tt.name, Password: tt.password})
+		c.expectAlert(tt.alert)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	name := uniqueName("Login")
+	createAccount(t, name, "secret")
+
+	tests := []struct {
+		name     string
+		password string
+		alert    string
+	}{
+		{name, "wrong", "That account name does not exist or the password is incorrect."},
+		{"NoSuchAccount", "secret", "That account name does not exist or the password is incorrect."},
+		{"ab", "secret", "Your account name must be between 3 and 20 characters long."},
+	}
+
+	for _, tt := range tests {
+		c := connect(t)
+		c.send(newLoginPacket(tt.name, tt.password))
+		c.expectAlert(tt.alert)
+	}
+
+	c, characters := login(t, name, "secret")
+	for i, info := range characters.Characters {
+		if info.Name != "" {
+			t.Errorf("slot %d of a new account holds character %q", i+1, info.Name)
+		}
+	}
+
+	// A second login to the same account is refused while the first one is still connected
+	second := connect(t)
+	second.send(newLoginPacket(name, "secret"))
+	second.expectAlert("Multiple account logins are not allowed.")
+
+	_ = c.conn.Close()
+}
+
+func TestCreateCharacter(t *testing.T) {
+	name := uniqueName("Character")
+	hero := uniqueName("Hero")
+	createAccount(t, name, "secret")
+
+	c, _ := login(t, name, "secret")
+	c.send(&ClCreateCharacterPacket{Name: hero, Gender: 0, Class: 1, Slot: 1})
+	c.expectAlert("Character has been created!")
+
+	c, characters := login(t, name, "secret")
+	if got := characters.Characters[0].Name; got != hero {
+		t.Errorf("slot 1 holds character %q, want %q", got, hero)
+	}
+
+	c.send(&ClCreateCharacterPacket{Name: hero, Gender: 1, Class: 1, Slot: 1})
+	c.expectAlert("Character already exists!")
+
+	c, _ = login(t, name, "secret")
+	c.send(&ClCreateCharacterPacket{Name: hero, Gender: 1, Class: 1, Slot: 2})
+	c.expectAlert("Sorry, but that name is in use!")
+}
+
+// TestManyClients checks that clients of the memory transport are not limited by the connections allowed per address.
+func TestManyClients(t *testing.T) {
+	names := make([]string, config.MaxConnectionsPerIP+2)
+	for i := range names {
+		names[i] = uniqueName("Many")
+		createAccount(t, names[i], "secret")
+	}
+
+	clients := make([]*testClient, len(names))
+	for i, name := range names {
+		clients[i], _ = login(t, name, "secret")
+	}
+	for _, c := range clients {
+		_ = c.conn.Close()
+	}
+}
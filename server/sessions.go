@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/utils"
+)
+
+// SetLinkDead keeps a player that lost their connection in game, so they can reconnect to their session.
+// The session ends when the player does not reconnect within the reconnect grace period.
+func SetLinkDead(player *PlayerData) {
+	player.Connection = nil
+	player.LinkDead = true
+	player.LinkDeadTime = utils.GetTickCount()
+
+	log.Printf("[%d] %s(%s) is link-dead\n", player.Id, player.Account.Name, player.Character.Name)
+}
+
+// UpdateSessions ends the sessions of players that have been link-dead for longer than the reconnect grace period.
+// It is called periodically from the game loop.
+func UpdateSessions(now int64) {
+	for i := 0; i < config.MaxPlayers; i++ {
+		player := &players[i]
+		if !player.LinkDead || now-player.LinkDeadTime < config.ReconnectGracePeriod*1000 {
+			continue
+		}
+
+		log.Printf("[%d] %s(%s) did not reconnect in time\n", player.Id, player.Account.Name, player.Character.Name)
+
+		EndSession(player)
+	}
+}
+
+// FindSession returns the session of the link-dead player with the specified account name, or nil if there is none.
+func FindSession(accountName string) *PlayerData {
+	for i := 0; i < config.MaxPlayers; i++ {
+		player := &players[i]
+		if player.LinkDead && strings.EqualFold(player.Account.Name, accountName) {
+			return player
+		}
+	}
+	return nil
+}
+
+// ResumeSession moves the connection of the player to the link-dead session and puts the session back in game.
+func ResumeSession(player *PlayerData, session *PlayerData) {
+	connId := player.Connection.Id()
+
+	session.Connection = player.Connection
+	session.Protocol = player.Protocol
+	session.Capabilities = player.Capabilities
+	session.Handshaked = player.Handshaked
+	session.rateLimiter = player.rateLimiter
+	session.LinkDead = false
+	session.LinkDeadTime = 0
+
+	connectionPlayers[connId] = session
+
+	// The connection has logged in, so the idle timeout applies to it instead of the login timeout
+	session.Connection.Authenticate()
+
+	player.Clear()
+
+	log.Printf("[%d] %s(%s) has reconnected from %s\n",
+		session.Id, session.Account.Name,
+		session.Character.Name,
+		session.Connection.RemoteAddr())
+
+	ResumeGame(session)
+}
+
+// EndSession removes the player from the game and frees up their slot.
+func EndSession(player *PlayerData) {
+	if player.Character != nil {
+		LeftGame(player)
+	}
+
+	player.Clear()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/guthius/mirage-nova/net"
+	"github.com/guthius/mirage-nova/server/color"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/data"
+	"github.com/guthius/mirage-nova/server/utils"
+)
+
+var shutdownTime int64
+
+// HandleShutdownSignals begins a graceful shutdown when the process receives SIGINT or SIGTERM.
+// A second signal terminates the process immediately.
+func HandleShutdownSignals(network *net.Network) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		QueueEvent(func() { BeginShutdown(network) })
+
+		<-signals
+		log.Println("Forcing shutdown, unsaved progress will be lost")
+		os.Exit(1)
+	}()
+}
+
+// BeginShutdown stops accepting new connections and starts the shutdown countdown.
+func BeginShutdown(network *net.Network) {
+	if IsShuttingDown {
+		return
+	}
+
+	IsShuttingDown = true
+	shutdownTime = utils.GetTickCount() + config.ShutdownCountdown*1000
+
+	network.StopAccepting()
+
+	log.Printf("Server is shutting down in %d seconds\n", config.ShutdownCountdown)
+
+	announceShutdown(config.ShutdownCountdown)
+}
+
+// UpdateShutdown counts down to the shutdown and shuts the server down once the countdown reaches zero.
+func UpdateShutdown(now int64) {
+	if !IsShuttingDown {
+		return
+	}
+
+	secondsLeft := int((shutdownTime - now + 999) / 1000)
+	if secondsLeft > 0 {
+		if secondsLeft <= 5 || secondsLeft%10 == 0 {
+			announceShutdown(secondsLeft)
+		}
+		return
+	}
+
+	SaveAll()
+
+	// Disconnect all players, the connections are closed once all pending data has been sent
+	for i := 0; i < config.MaxPlayers; i++ {
+		player := GetPlayer(i)
+		if player.IsConnected() {
+			SendAlert(player, fmt.Sprintf("%s is shutting down. Please try again later.", config.GameName))
+		}
+	}
+
+	StopGameLoop()
+}
+
+func announceShutdown(secondsLeft int) {
+	if secondsLeft == 1 {
+		SendGlobalMessage("Server shutdown in 1 second.", color.BrightRed)
+		return
+	}
+
+	SendGlobalMessage(fmt.Sprintf("Server shutdown in %d seconds.", secondsLeft), color.BrightRed)
+}
+
+// SaveAll saves all modified game content and queues a save of all characters that are in game.
+// The characters have been saved once WaitForSaves returns, which also returns the error if saving them failed.
+func SaveAll() {
+	queueSave(snapshotCharacters(), func(err error, elapsed time.Duration) {
+		if err != nil {
+			recordSaveError(fmt.Errorf("saving characters in game: %w", err))
+		}
+	})
+
+	data.SaveDirty()
+
+	log.Println("All game content has been saved")
+}
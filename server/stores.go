@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/guthius/mirage-nova/server/character"
+	"github.com/guthius/mirage-nova/server/config"
+	"github.com/guthius/mirage-nova/server/database"
+	"github.com/guthius/mirage-nova/server/user"
+)
+
+const (
+	accountsDbPath   = "data/accounts.db"
+	charactersDbPath = "data/characters.db"
+)
+
+var accountsDb *sql.DB
+var charactersDb *sql.DB
+
+var accountStore *user.Store
+var characterStore *character.Store
+
+// OpenStores opens the databases and creates the stores through which accounts and characters are accessed.
+// The schemas of the databases are migrated when AutoMigrate is enabled; otherwise, they must already be up to date.
+func OpenStores() error {
+	var err error
+
+	accountsDb, err = openDatabase(accountsDbPath, user.Migrations)
+	if err != nil {
+		return err
+	}
+
+	charactersDb, err = openDatabase(charactersDbPath, character.Migrations)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	accountStore, err = user.NewStore(ctx, accountsDb)
+	if err != nil {
+		return err
+	}
+
+	characterStore, err = character.NewStore(ctx, charactersDb)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CloseStores closes the stores and the databases they use.
+func CloseStores() {
+	closers := []interface{ Close() error }{accountStore, accountsDb, characterStore, charactersDb}
+
+	for _, c := range closers {
+		err := c.Close()
+		if err != nil {
+			log.Printf("Failed to close database (%s)\n", err)
+		}
+	}
+}
+
+// openDatabase opens the database at the specified path and makes sure its schema is up to date.
+func openDatabase(path string, migrations []database.Migration) (*sql.DB, error) {
+	db, err := database.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AutoMigrate {
+		err = migrateDatabase(path, db, migrations)
+	} else {
+		err = database.CheckVersion(context.Background(), db, migrations)
+	}
+
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// migrateDatabase applies all pending migrations to the database and logs the ones that were applied.
+func migrateDatabase(path string, db *sql.DB, migrations []database.Migration) error {
+	applied, err := database.Migrate(context.Background(), db, migrations)
+
+	for _, m := range applied {
+		log.Printf("Applied migration %d (%s) to %s\n", m.Version, m.Description, path)
+	}
+
+	return err
+}
+
+// MigrateDatabases applies all pending migrations to the account and character databases.
+func MigrateDatabases() error {
+	databases := []struct {
+		path       string
+		migrations []database.Migration
+	}{
+		{accountsDbPath, user.Migrations},
+		{charactersDbPath, character.Migrations},
+	}
+
+	for _, d := range databases {
+		db, err := database.Open(d.path)
+		if err != nil {
+			return err
+		}
+
+		err = migrateDatabase(d.path, db, d.migrations)
+		_ = db.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.path, err)
+		}
+	}
+
+	return nil
+}
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"github.com/guthius/mirage-nova/net"
 	"github.com/guthius/mirage-nova/server/color"
 	"github.com/guthius/mirage-nova/server/data"
 	"github.com/guthius/mirage-nova/server/data/vitals"
-	"github.com/guthius/mirage-nova/server/utils"
 )
 
 // TriggerTileEffect triggers the effect of the tile the player is standing on.
@@ -27,19 +25,7 @@ func TriggerTileEffect(player *PlayerData) {
 		MovePlayerToRoom(player, tile.Data.Data1, tile.Data.Data2, tile.Data.Data3)
 
 	case data.TileTypeKeyOpen:
-		doorX := tile.Data.Data1
-		doorY := tile.Data.Data2
-		if !tile.DoorOpen {
-			tile.DoorOpen = true
-			tile.DoorTimer = utils.GetTickCount()
-
-			buffer := net.NewWriter()
-			buffer.WriteInteger(SvMapKey)
-			buffer.WriteLong(doorX)
-			buffer.WriteLong(doorY)
-			buffer.WriteLong(1)
-
-			player.Room.Send(buffer.Bytes())
+		if player.Room.OpenDoor(tile.Data.Data1, tile.Data.Data2) {
 			player.Room.SendMessage("A door has been unlocked.", color.White)
 		}
 
@@ -0,0 +1,18 @@
+package user
+
+import "github.com/guthius/mirage-nova/server/database"
+
+// Migrations are the migrations that bring the schema of the accounts database up to date.
+var Migrations = []database.Migration{
+	{
+		Version:     1,
+		Description: "create accounts table",
+		Up: database.Exec(`CREATE TABLE IF NOT EXISTS accounts (
+    		id INTEGER PRIMARY KEY AUTOINCREMENT,
+    		name TEXT UNIQUE COLLATE NOCASE,
+    		password_hash TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			created_from_ip TEXT
+    	)`),
+	},
+}
@@ -1,67 +1,76 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/guthius/mirage-nova/server/database"
 	"github.com/guthius/mirage-nova/server/utils"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// PasswordCost is the bcrypt cost of the password hashes of new accounts.
+// Tests lower it, as hashing at the default cost takes a long time with the race detector enabled.
+var PasswordCost = bcrypt.DefaultCost
+
 type Account struct {
 	Id           int64
 	Name         string
 	PasswordHash string
 }
 
-func init() {
-	db, err := openDatabase()
-	if err != nil {
-		log.Fatal(err)
-	}
+// Store provides access to the accounts stored in a database.
+type Store struct {
+	db         *sql.DB
+	statements *database.Statements
+	exists     *sql.Stmt
+	load       *sql.Stmt
+	create     *sql.Stmt
+	save       *sql.Stmt
+}
 
-	defer db.Close()
+// NewStore prepares the statements used by the store. The schema of the database must be up to date with Migrations.
+// The database must remain open for as long as the store is used.
+func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
+	statements := database.NewStatements(db)
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS accounts (
-    		id INTEGER PRIMARY KEY AUTOINCREMENT,
-    		name TEXT UNIQUE COLLATE NOCASE,
-    		password_hash TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			created_from_ip TEXT
-    	)`)
+	store := &Store{
+		db:         db,
+		statements: statements,
+		exists:     statements.Prepare(ctx, "SELECT COUNT(id) FROM accounts WHERE name = ?"),
+		load:       statements.Prepare(ctx, "SELECT id, name, password_hash FROM accounts WHERE name = ?"),
+		create:     statements.Prepare(ctx, "INSERT INTO accounts (name, password_hash, created_from_ip) VALUES (?, ?, ?)"),
+		save:       statements.Prepare(ctx, "UPDATE accounts SET password_hash = ? WHERE id = ?"),
+	}
 
+	err := statements.Err()
 	if err != nil {
-		log.Panic(err)
+		_ = statements.Close()
+		return nil, err
 	}
+
+	return store, nil
+}
+
+// Close closes the prepared statements of the store. It does not close the database.
+func (s *Store) Close() error {
+	return s.statements.Close()
 }
 
 // Exists checks if an account with the specified name exists in the database.
-func Exists(accountName string) bool {
+func (s *Store) Exists(ctx context.Context, accountName string) bool {
 	if !utils.IsValidName(accountName) {
 		return false
 	}
 
-	db, err := openDatabase()
-	if err != nil {
-		return false
-	}
-
-	stmt, err := db.Prepare("SELECT COUNT(id) FROM accounts WHERE name = ?")
-	if err != nil {
-		return false
-	}
-
-	defer stmt.Close()
-
-	row := stmt.QueryRow(accountName)
+	row := s.exists.QueryRowContext(ctx, accountName)
 
 	var count int64
 
-	err = row.Scan(&count)
+	err := row.Scan(&count)
 	if err != nil {
 		return false
 	}
@@ -70,30 +79,16 @@ func Exists(accountName string) bool {
 }
 
 // Load loads the account with the specified name from the database.
-func Load(accountName string) *Account {
+func (s *Store) Load(ctx context.Context, accountName string) *Account {
 	if !utils.IsValidName(accountName) {
 		return nil
 	}
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Printf("error loading account '%s' (%s)\n", accountName, err)
-		return nil
-	}
-
-	stmt, err := db.Prepare("SELECT id, name, password_hash FROM accounts WHERE name = ?")
-	if err != nil {
-		log.Printf("error loading account '%s' (%s)\n", accountName, err)
-		return nil
-	}
-
-	defer stmt.Close()
-
-	row := stmt.QueryRow(accountName)
+	row := s.load.QueryRowContext(ctx, accountName)
 
 	var account Account
 
-	err = row.Scan(&account.Id, &account.Name, &account.PasswordHash)
+	err := row.Scan(&account.Id, &account.Name, &account.PasswordHash)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil
@@ -106,12 +101,12 @@ func Load(accountName string) *Account {
 }
 
 // Create creates a new account with the specified name and password.
-func Create(accountName string, password string, createdFromIp string) (*Account, bool) {
-	if Exists(accountName) {
+func (s *Store) Create(ctx context.Context, accountName string, password string, createdFromIp string) (*Account, bool) {
+	if s.Exists(ctx, accountName) {
 		return nil, false
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
 	if err != nil {
 		return nil, false
 	}
@@ -121,21 +116,7 @@ func Create(accountName string, password string, createdFromIp string) (*Account
 		PasswordHash: string(passwordHash),
 	}
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Printf("error creating account '%s' (%s)\n", account.Name, err)
-		return nil, false
-	}
-
-	stmt, err := db.Prepare("INSERT INTO accounts (name, password_hash, created_from_ip) VALUES (?, ?, ?)")
-	if err != nil {
-		log.Printf("error creating account '%s' (%s)\n", account.Name, err)
-		return nil, false
-	}
-
-	defer stmt.Close()
-
-	r, err := stmt.Exec(account.Name, account.PasswordHash, createdFromIp)
+	r, err := s.create.ExecContext(ctx, account.Name, account.PasswordHash, createdFromIp)
 	if err != nil {
 		log.Printf("error creating account '%s' (%s)\n", account.Name, err)
 		return nil, false
@@ -153,26 +134,12 @@ func Create(accountName string, password string, createdFromIp string) (*Account
 }
 
 // Save saves the account to the database.
-func (account *Account) Save() bool {
+func (s *Store) Save(ctx context.Context, account *Account) bool {
 	if account == nil || len(account.Name) == 0 {
 		return false
 	}
 
-	db, err := openDatabase()
-	if err != nil {
-		log.Printf("error saving account '%s' (%s)\n", account.Name, err)
-		return false
-	}
-
-	stmt, err := db.Prepare("UPDATE accounts SET password_hash = ? WHERE id = ?")
-	if err != nil {
-		log.Printf("error saving account '%s' (%s)\n", account.Name, err)
-		return false
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(account.PasswordHash, account.Id)
+	_, err := s.save.ExecContext(ctx, account.PasswordHash, account.Id)
 	if err != nil {
 		log.Printf("error saving account '%s' (%s)\n", account.Name, err)
 		return false
@@ -189,12 +156,3 @@ func (account *Account) IsPasswordCorrect(password string) bool {
 	)
 	return err == nil
 }
-
-// openDatabase opens the SQLite database and returns a database handle.
-func openDatabase() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "data/accounts.db")
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
-}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLiteStore is a Store that keeps each record as JSON in a row of a database table.
+// The JSON functions of SQLite can be used to query the records from outside the server.
+type SQLiteStore[K any] struct {
+	db     *sql.DB
+	reset  func(item *K)
+	load   string
+	save   string
+	delete string
+	list   string
+}
+
+// NewSQLiteStore returns a store that keeps its records in the specified table, which is created if it does not exist.
+// The database must remain open for as long as the store is used.
+func NewSQLiteStore[K any](db *sql.DB, table string, reset func(*K)) (*SQLiteStore[K], error) {
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY,
+			data TEXT NOT NULL
+		)`, table))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteStore[K]{
+		db:     db,
+		reset:  reset,
+		load:   fmt.Sprintf("SELECT data FROM %s WHERE id = ?", table),
+		save:   fmt.Sprintf("INSERT INTO %s (id, data) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data", table),
+		delete: fmt.Sprintf("DELETE FROM %s WHERE id = ?", table),
+		list:   fmt.Sprintf("SELECT id FROM %s ORDER BY id", table),
+	}, nil
+}
+
+func (s *SQLiteStore[K]) Load(id int) (*K, error) {
+	data := new(K)
+	s.reset(data)
+
+	var bytes []byte
+
+	err := s.db.QueryRow(s.load, id).Scan(&bytes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return data, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(bytes, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *SQLiteStore[K]) Save(id int, data *K) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(s.save, id, string(bytes))
+	return err
+}
+
+func (s *SQLiteStore[K]) Delete(id int) error {
+	_, err := s.db.Exec(s.delete, id)
+	return err
+}
+
+func (s *SQLiteStore[K]) List() ([]int, error) {
+	rows, err := s.db.Query(s.list)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
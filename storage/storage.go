@@ -1,59 +1,372 @@
 ﻿package storage
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log"
 	"os"
 	"path"
+	"slices"
+	"strconv"
+	"strings"
 )
 
+// ErrCorrupt is returned when a file does not contain the data that was written to it.
+var ErrCorrupt = errors.New("storage: file is corrupt")
+
+// Store is implemented by all backends in which records of type K can be stored.
+// Records are identified by a non-negative ID.
+type Store[K any] interface {
+	// Load returns the record with the specified ID. Records that do not exist are returned with their default values.
+	Load(id int) (*K, error)
+	// Save stores the record with the specified ID, replacing any existing record.
+	Save(id int, data *K) error
+	// Delete removes the record with the specified ID. Deleting a record that does not exist is not an error.
+	Delete(id int) error
+	// List returns the IDs of all stored records in ascending order.
+	List() ([]int, error)
+}
+
+// FileStore is a Store that keeps each record in a separate file, named after the prefix and ID of the record.
+//
+// Files are written to a temporary file first, which replaces the actual file once it has been flushed to disk,
+// so a crash while saving never leaves a partially written file behind. Optionally, the previous versions
+// of a file are kept as backups, which are loaded instead when the file itself is corrupt.
 type FileStore[K any] struct {
-	path   string
-	prefix string
-	reset  func(item *K)
+	path    string
+	prefix  string
+	format  fileFormat
+	reset   func(item *K)
+	backups int
+}
+
+type fileFormat struct {
+	extension string
+	checksum  bool // Whether files start with a header that is used to detect corruption.
+	encode    func(w io.Writer, v any) error
+	decode    func(r io.Reader, v any) error
+}
+
+var gobFormat = fileFormat{
+	extension: ".gob",
+	checksum:  true,
+	encode:    func(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) },
+	decode:    func(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) },
+}
+
+var jsonFormat = fileFormat{
+	extension: ".json",
+	encode: func(w io.Writer, v any) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	},
+	decode: func(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) },
 }
 
+// NewFileStore returns a store that keeps each record gob encoded in its own file.
 func NewFileStore[K any](path string, prefix string, reset func(*K)) *FileStore[K] {
+	return newFileStore(path, prefix, gobFormat, reset)
+}
+
+// NewJSONFileStore returns a store that keeps each record as pretty-printed JSON in its own file.
+func NewJSONFileStore[K any](path string, prefix string, reset func(*K)) *FileStore[K] {
+	return newFileStore(path, prefix, jsonFormat, reset)
+}
+
+func newFileStore[K any](path string, prefix string, format fileFormat, reset func(*K)) *FileStore[K] {
 	createFolderIfNotExists(path)
 	return &FileStore[K]{
 		path:   path,
 		prefix: prefix,
+		format: format,
 		reset:  reset,
 	}
 }
 
+// SetBackups sets the number of previous versions of each file that are kept. Zero disables backups.
+func (fs *FileStore[K]) SetBackups(n int) *FileStore[K] {
+	fs.backups = max(n, 0)
+	return fs
+}
+
+// filename returns the path of the file in which the record with the specified ID is stored.
+func (fs *FileStore[K]) filename(id int) string {
+	return path.Join(fs.path, fmt.Sprintf("%s%d%s", fs.prefix, id, fs.format.extension))
+}
+
+// backupName returns the path of the n-th most recent backup of the specified file.
+func backupName(filename string, n int) string {
+	return fmt.Sprintf("%s.bak%d", filename, n)
+}
+
+// Load returns the record with the specified ID.
+// When the file of the record can not be loaded, the most recent backup that can be loaded is returned instead.
 func (fs *FileStore[K]) Load(id int) (*K, error) {
-	filename := path.Join(fs.path, fmt.Sprintf("%s%d.gob", fs.prefix, id))
-	file, err := os.Open(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			data := new(K)
-			fs.reset(data)
-			return data, nil
+	filename := fs.filename(id)
+
+	data, err := fs.loadFile(filename)
+	if err == nil {
+		return data, nil
+	}
+
+	for n := 1; n <= fs.backups; n++ {
+		backup := backupName(filename, n)
+
+		data, backupErr := fs.loadFile(backup)
+		if backupErr != nil {
+			continue
 		}
+
+		log.Printf("Unable to load %s (%s), using backup %s\n", filename, err, backup)
+
+		return data, nil
+	}
+
+	if os.IsNotExist(err) {
+		data = new(K)
+		fs.reset(data)
+		return data, nil
+	}
+
+	return nil, err
+}
+
+func (fs *FileStore[K]) loadFile(filename string) (*K, error) {
+	payload, err := os.ReadFile(filename)
+	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	decoder := gob.NewDecoder(file)
+
+	if fs.format.checksum {
+		payload, err = checkHeader(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	data := new(K)
 	fs.reset(data)
-	err = decoder.Decode(data)
+	err = fs.format.decode(bytes.NewReader(payload), data)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
+// Save writes the record with the specified ID to its file, keeping the previous version as a backup if enabled.
 func (fs *FileStore[K]) Save(id int, data *K) error {
-	filename := path.Join(fs.path, fmt.Sprintf("%s%d.gob", fs.prefix, id))
-	file, err := os.Create(filename)
+	var buf bytes.Buffer
+	err := fs.format.encode(&buf, data)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(data)
+
+	payload := buf.Bytes()
+	if fs.format.checksum {
+		payload = addHeader(payload)
+	}
+
+	filename := fs.filename(id)
+
+	temp, err := writeTempFile(filename, payload)
+	if err != nil {
+		return err
+	}
+
+	if fs.backups > 0 {
+		err = rotateBackups(filename, fs.backups)
+		if err != nil {
+			_ = os.Remove(temp)
+			return err
+		}
+	}
+
+	err = os.Rename(temp, filename)
+	if err != nil {
+		_ = os.Remove(temp)
+		return err
+	}
+
+	syncDir(fs.path)
+
+	return nil
+}
+
+// Delete removes the file of the record with the specified ID along with its backups.
+func (fs *FileStore[K]) Delete(id int) error {
+	filename := fs.filename(id)
+
+	err := os.Remove(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for n := 1; n <= fs.backups; n++ {
+		err = os.Remove(backupName(filename, n))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs *FileStore[K]) List() ([]int, error) {
+	entries, err := os.ReadDir(fs.path)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), fs.prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		name, ok = strings.CutSuffix(name, fs.format.extension)
+		if !ok {
+			continue
+		}
+
+		id, err := strconv.Atoi(name)
+		if err != nil || id < 0 {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+// The header of a file with a checksum consists of a magic number, the length of the payload and a CRC-32 of the payload.
+const (
+	headerMagic = "MNS1"
+	headerSize  = 12
+)
+
+func addHeader(payload []byte) []byte {
+	file := make([]byte, headerSize, headerSize+len(payload))
+	copy(file, headerMagic)
+	binary.LittleEndian.PutUint32(file[4:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(file[8:], crc32.ChecksumIEEE(payload))
+	return append(file, payload...)
+}
+
+// checkHeader verifies the checksum of the file and returns its payload.
+// Files that were written before checksums were added have no header and are returned unchanged.
+func checkHeader(file []byte) ([]byte, error) {
+	if !bytes.HasPrefix(file, []byte(headerMagic)) {
+		return file, nil
+	}
+
+	if len(file) < headerSize {
+		return nil, ErrCorrupt
+	}
+
+	payload := file[headerSize:]
+	if binary.LittleEndian.Uint32(file[4:]) != uint32(len(payload)) ||
+		binary.LittleEndian.Uint32(file[8:]) != crc32.ChecksumIEEE(payload) {
+		return nil, ErrCorrupt
+	}
+
+	return payload, nil
+}
+
+// writeTempFile writes the data to a new temporary file next to the specified file and flushes it to disk.
+// It returns the name of the temporary file.
+func writeTempFile(filename string, data []byte) (string, error) {
+	file, err := os.CreateTemp(path.Dir(filename), path.Base(filename)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// rotateBackups shifts the backups of the specified file by one, dropping the oldest,
+// and makes the current version of the file the most recent backup.
+// The file itself is left in place, so it still exists when the new version is never renamed over it.
+func rotateBackups(filename string, backups int) error {
+	for n := backups; n > 1; n-- {
+		err := os.Rename(backupName(filename, n-1), backupName(filename, n))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	backup := backupName(filename, 1)
+
+	err := os.Remove(backup)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The file is replaced by a rename rather than written to, so a hard link keeps the current version intact
+	err = os.Link(filename, backup)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+
+	// Not all file systems support hard links
+	return copyFile(filename, backup)
+}
+
+// copyFile atomically replaces the destination file with a copy of the source file.
+func copyFile(src string, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	temp, err := writeTempFile(dst, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(temp, dst)
+	if err != nil {
+		_ = os.Remove(temp)
+		return err
+	}
+
+	return nil
+}
+
+// syncDir flushes the directory entries of the specified directory to disk, so a rename survives a crash.
+// Not all platforms support this, so errors are ignored.
+func syncDir(dir string) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = file.Sync()
+	_ = file.Close()
 }
 
 func createFolderIfNotExists(folderName string) {
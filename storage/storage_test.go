@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"testing"
+)
+
+type testRecord struct {
+	Name  string
+	Value int
+}
+
+func resetTestRecord(r *testRecord) {
+	r.Name = ""
+	r.Value = -1
+}
+
+func loadValue(t *testing.T, fs *FileStore[testRecord], filename string) int {
+	t.Helper()
+
+	record, err := fs.loadFile(filename)
+	if err != nil {
+		t.Fatalf("loading %s: %v", filename, err)
+	}
+	return record.Value
+}
+
+func TestSaveRotatesBackups(t *testing.T) {
+	tests := []struct {
+		name    string
+		backups int
+		saves   int
+		want    []int // The values in the file followed by its backups, from newest to oldest.
+	}{
+		{"no backups", 0, 3, []int{3}},
+		{"first save", 2, 1, []int{1}},
+		{"one backup", 1, 3, []int{3, 2}},
+		{"all backups", 2, 2, []int{2, 1}},
+		{"oldest dropped", 2, 5, []int{5, 4, 3}},
+	}
+
+	for _, tt := range tests {
+		fs := NewFileStore(t.TempDir(), "record", resetTestRecord).SetBackups(tt.backups)
+
+		for i := 1; i <= tt.saves; i++ {
+			if err := fs.Save(1, &testRecord{Name: "test", Value: i}); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+
+		filename := fs.filename(1)
+		if got := loadValue(t, fs, filename); got != tt.want[0] {
+			t.Errorf("%s: file holds version %d, want %d", tt.name, got, tt.want[0])
+		}
+
+		for n := 1; n <= tt.backups; n++ {
+			backup := backupName(filename, n)
+			if n >= len(tt.want) {
+				if _, err := os.Stat(backup); !os.IsNotExist(err) {
+					t.Errorf("%s: backup %d exists", tt.name, n)
+				}
+				continue
+			}
+			if got := loadValue(t, fs, backup); got != tt.want[n] {
+				t.Errorf("%s: backup %d holds version %d, want %d", tt.name, n, got, tt.want[n])
+			}
+		}
+	}
+}
+
+// TestRotateBackupsKeepsFile checks that the file can still be loaded when the process stops
+// after the backups were rotated but before the new version was renamed over the file.
+func TestRotateBackupsKeepsFile(t *testing.T) {
+	fs := NewFileStore(t.TempDir(), "record", resetTestRecord).SetBackups(2)
+
+	for i := 1; i <= 2; i++ {
+		if err := fs.Save(1, &testRecord{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filename := fs.filename(1)
+	if err := rotateBackups(filename, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loadValue(t, fs, filename); got != 2 {
+		t.Errorf("file holds version %d after rotating the backups, want 2", got)
+	}
+	if got := loadValue(t, fs, backupName(filename, 1)); got != 2 {
+		t.Errorf("backup 1 holds version %d, want 2", got)
+	}
+	if got := loadValue(t, fs, backupName(filename, 2)); got != 1 {
+		t.Errorf("backup 2 holds version %d, want 1", got)
+	}
+
+	// Saving the next version must not change the backup that shares its contents with the file
+	if err := fs.Save(1, &testRecord{Value: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadValue(t, fs, backupName(filename, 1)); got != 2 {
+		t.Errorf("backup 1 holds version %d after saving, want 2", got)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := dir + "/src"
+	dst := dir + "/dst"
+
+	if err := os.WriteFile(src, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("old contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("copy holds %q, want %q", got, "new")
+	}
+
+	if err := copyFile(dir+"/missing", dst); !os.IsNotExist(err) {
+		t.Errorf("copying a missing file returned %v, want a not exist error", err)
+	}
+}
+
+func TestCheckHeader(t *testing.T) {
+	payload := []byte("payload")
+	file := addHeader(payload)
+
+	corrupt := func(i int) []byte {
+		data := bytes.Clone(file)
+		data[i] ^= 0xFF
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		file    []byte
+		want    []byte
+		wantErr error
+	}{
+		{"valid", file, payload, nil},
+		{"empty payload", addHeader(nil), []byte{}, nil},
+		{"no header", payload, payload, nil},
+		{"empty file", []byte{}, []byte{}, nil},
+		{"truncated header", file[:headerSize-1], nil, ErrCorrupt},
+		{"truncated payload", file[:len(file)-1], nil, ErrCorrupt},
+		{"appended data", append(bytes.Clone(file), 0), nil, ErrCorrupt},
+		{"wrong length", corrupt(4), nil, ErrCorrupt},
+		{"wrong checksum", corrupt(8), nil, ErrCorrupt},
+		{"changed payload", corrupt(headerSize), nil, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		got, err := checkHeader(tt.file)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: checkHeader returned error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: checkHeader returned payload %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFallsBackToBackup(t *testing.T) {
+	const missing = -2 // The value of a file that is left out.
+
+	tests := []struct {
+		name    string
+		file    int // The value in the file, missing, or zero for a corrupt file.
+		backups []int
+		want    int
+		wantErr error
+	}{
+		{"valid file", 3, []int{2, 1}, 3, nil},
+		{"corrupt file", 0, []int{2, 1}, 2, nil},
+		{"missing file", missing, []int{2, 1}, 2, nil},
+		{"corrupt file and backup", 0, []int{0, 1}, 1, nil},
+		{"missing file and backup", missing, []int{missing, 1}, 1, nil},
+		{"no backups", missing, []int{missing, missing}, -1, nil},
+		{"everything corrupt", 0, []int{0, 0}, 0, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		fs := NewFileStore(t.TempDir(), "record", resetTestRecord).SetBackups(len(tt.backups))
+		filename := fs.filename(1)
+
+		writeTestFile(t, filename, tt.file)
+		for n, value := range tt.backups {
+			writeTestFile(t, backupName(filename, n+1), value)
+		}
+
+		record, err := fs.Load(1)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Load returned error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && record.Value != tt.want {
+			t.Errorf("%s: loaded version %d, want %d", tt.name, record.Value, tt.want)
+		}
+	}
+}
+
+// writeTestFile writes a record with the specified value to the file.
+// A value of zero writes a file with a checksum that does not match its payload, and a negative value writes no file.
+func writeTestFile(t *testing.T, filename string, value int) {
+	t.Helper()
+
+	if value < 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(testRecord{Name: "test", Value: value}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := addHeader(buf.Bytes())
+	if value == 0 {
+		file[len(file)-1] ^= 0xFF
+	}
+
+	if err := os.WriteFile(filename, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFileWithoutHeader(t *testing.T) {
+	fs := NewFileStore(t.TempDir(), "record", resetTestRecord)
+
+	// Files written before checksums were added are plain gob
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(testRecord{Name: "legacy", Value: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fs.filename(1), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := fs.Load(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Name != "legacy" || record.Value != 7 {
+		t.Errorf("loaded %+v, want the legacy record", *record)
+	}
+}